@@ -4,6 +4,7 @@ go 1.24.3
 
 require (
 	github.com/google/go-cmp v0.7.0
+	github.com/pelletier/go-toml/v2 v2.2.4
 	github.com/telemachus/opts v0.4.0
 )
 
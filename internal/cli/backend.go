@@ -0,0 +1,55 @@
+package cli
+
+import "context"
+
+// gitBackend performs git operations on plugin repositories. Tests substitute
+// a fake for the git command. Operations that use the network (clone, fetch,
+// defaultBranch, fetchRef, sharesCommits, resetTo, checkoutRef, switchBranch,
+// and updateSubmodules) run until ctx is done; callers set their timeouts.
+type gitBackend interface {
+	// clone clones url into destDir. The branch may also be a tag, and if
+	// branch is empty, the remote's default branch is checked out.
+	clone(ctx context.Context, url, branch, destDir string) error
+	// fetch updates the remote-tracking copy of branch and returns the
+	// commit at its tip.
+	fetch(ctx context.Context, repoDir, branch string) (digest, error)
+	// defaultBranch returns the branch that the remote's HEAD points to.
+	defaultBranch(ctx context.Context, repoDir string) (string, error)
+	// fetchRef fetches from the remote and returns the commit that a commit
+	// or tag names.
+	fetchRef(ctx context.Context, repoDir, ref string) (digest, error)
+	// isAncestor reports whether ancestor is reachable from descendant.
+	isAncestor(ctx context.Context, repoDir string, ancestor, descendant digest) (bool, error)
+	// sharesHistory reports whether two commits have a common ancestor.
+	sharesHistory(ctx context.Context, repoDir string, a, b digest) (bool, error)
+	// sharesCommits reports whether any branch or tag of the repository at
+	// url is at a commit that a local ref is also at. It fetches nothing.
+	sharesCommits(ctx context.Context, repoDir, url string) (bool, error)
+	// setURL changes the URL of the origin remote.
+	setURL(ctx context.Context, repoDir, url string) error
+	// switchBranch checks out branch at the tip of origin's copy of it, as
+	// last fetched, discarding any local changes.
+	switchBranch(ctx context.Context, repoDir, branch string) error
+	// resetTo moves the checked-out branch to commit.
+	resetTo(ctx context.Context, repoDir string, commit digest) error
+	// checkoutRef detaches HEAD at a commit or tag.
+	checkoutRef(ctx context.Context, repoDir, ref string) error
+	// updateSubmodules brings submodules, including nested ones, in line
+	// with the checked-out commit, initializing them as needed.
+	updateSubmodules(ctx context.Context, repoDir string) error
+	// repoURL returns the URL of the origin remote.
+	repoURL(ctx context.Context, repoDir string) (string, error)
+	// getBranchInfo returns the checked-out branch and commit.
+	getBranchInfo(ctx context.Context, repoDir string) (branchInfo, error)
+	// tagCommit returns the commit that a local tag names, or nil if there
+	// is no such tag.
+	tagCommit(ctx context.Context, repoDir, tag string) (digest, error)
+	// commitsBetween returns one-line summaries of the commits that newHash
+	// has but oldHash does not, newest first.
+	commitsBetween(ctx context.Context, repoDir string, oldHash, newHash digest) ([]string, error)
+	// isDirty reports whether tracked files have uncommitted changes.
+	isDirty(ctx context.Context, repoDir string) (bool, error)
+	// hasUnpushed reports whether HEAD has commits that no remote branch or
+	// tag contains.
+	hasUnpushed(ctx context.Context, repoDir string) (bool, error)
+}
@@ -0,0 +1,590 @@
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testRemotes hosts the remote repositories that a test syncs plugins from.
+type testRemotes interface {
+	backend() gitBackend
+	url(name string) string
+	// commit adds a commit to a branch of a remote, creating both as needed.
+	commit(t *testing.T, name, branch, subject string)
+	// rewrite replaces the newest commit on a branch of a remote and
+	// force-pushes the branch.
+	rewrite(t *testing.T, name, branch, subject string)
+	// mirror makes a copy of a remote, with the same history, under a
+	// new name.
+	mirror(t *testing.T, name, mirrorName string)
+	// setDefault points a remote's HEAD at branch.
+	setDefault(t *testing.T, name, branch string)
+	// tag tags the newest commit on a remote's main branch.
+	tag(t *testing.T, name, tag string)
+	// modify makes an uncommitted change to a tracked file in a plugin.
+	modify(t *testing.T, pluginDir string)
+}
+
+// fakeDirtyFile marks a repository of the fake backend as having uncommitted
+// changes.
+const fakeDirtyFile = "FAKE_DIRTY"
+
+type fakeCommit struct {
+	subject string
+	hash    digest
+}
+
+type fakeRemote struct {
+	branches map[string][]fakeCommit // Oldest commit first
+	tags     map[string]digest
+	head     string       // Default branch; "" for main
+	dropped  []fakeCommit // Commits that a force push removed
+}
+
+// fakeGit is an in-process gitBackend. Its remotes live in memory, but its
+// clones live on disk, with just enough metadata for pluggo to read them.
+type fakeGit struct {
+	remotes map[string]*fakeRemote
+	mu      sync.Mutex
+	commits int
+}
+
+func newFakeGit() *fakeGit {
+	return &fakeGit{remotes: make(map[string]*fakeRemote)}
+}
+
+func (f *fakeGit) backend() gitBackend {
+	return f
+}
+
+func (f *fakeGit) url(name string) string {
+	return "https://example.com/" + name + ".git"
+}
+
+func (f *fakeGit) commit(t *testing.T, name, branch, subject string) {
+	t.Helper()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	url := f.url(name)
+	remote, ok := f.remotes[url]
+	if !ok {
+		remote = &fakeRemote{
+			branches: make(map[string][]fakeCommit),
+			tags:     make(map[string]digest),
+		}
+		f.remotes[url] = remote
+	}
+
+	// New branches start from main, as if created there.
+	history, ok := remote.branches[branch]
+	if !ok {
+		history = slices.Clone(remote.branches["main"])
+	}
+
+	remote.branches[branch] = append(history, f.newCommit(url, subject))
+}
+
+func (f *fakeGit) rewrite(t *testing.T, name, branch, subject string) {
+	t.Helper()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	url := f.url(name)
+	remote := f.remotes[url]
+	history := remote.branches[branch]
+	last := len(history) - 1
+	remote.dropped = append(remote.dropped, history[last])
+	remote.branches[branch] = append(history[:last:last], f.newCommit(url, subject))
+}
+
+func (f *fakeGit) mirror(t *testing.T, name, mirrorName string) {
+	t.Helper()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.remotes[f.url(mirrorName)] = f.remotes[f.url(name)]
+}
+
+func (f *fakeGit) setDefault(t *testing.T, name, branch string) {
+	t.Helper()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.remotes[f.url(name)].head = branch
+}
+
+func (f *fakeGit) newCommit(url, subject string) fakeCommit {
+	f.commits++
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s %s %d", url, subject, f.commits))
+
+	return fakeCommit{hash: digest(fmt.Sprintf("%x", sum)[:40]), subject: subject}
+}
+
+func (f *fakeGit) tag(t *testing.T, name, tag string) {
+	t.Helper()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	remote := f.remotes[f.url(name)]
+	history := remote.branches["main"]
+	remote.tags[tag] = history[len(history)-1].hash
+}
+
+func (f *fakeGit) modify(t *testing.T, pluginDir string) {
+	t.Helper()
+
+	writeFiles(t, pluginDir, map[string]string{".git/" + fakeDirtyFile: ""})
+}
+
+func (f *fakeGit) clone(_ context.Context, url, branch, destDir string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	remote, ok := f.remotes[url]
+	if !ok {
+		return fmt.Errorf("repository %q not found", url)
+	}
+
+	if branch == "" {
+		branch = remote.defaultBranch()
+	}
+
+	if hash, ok := remote.tags[branch]; ok {
+		return writeFakeRepo(destDir, url, "", hash)
+	}
+
+	history, ok := remote.branches[branch]
+	if !ok {
+		return fmt.Errorf("remote branch %q not found", branch)
+	}
+
+	return writeFakeRepo(destDir, url, branch, history[len(history)-1].hash)
+}
+
+func (f *fakeGit) fetch(_ context.Context, repoDir, branch string) (digest, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	remote, _, err := f.open(repoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	history, ok := remote.branches[branch]
+	if !ok {
+		return nil, fmt.Errorf("remote branch %q not found", branch)
+	}
+
+	return history[len(history)-1].hash, nil
+}
+
+func (f *fakeGit) defaultBranch(_ context.Context, repoDir string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	remote, _, err := f.open(repoDir)
+	if err != nil {
+		return "", err
+	}
+
+	return remote.defaultBranch(), nil
+}
+
+func (f *fakeGit) isAncestor(_ context.Context, repoDir string, ancestor, descendant digest) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	remote, _, err := f.open(repoDir)
+	if err != nil {
+		return false, err
+	}
+
+	for _, history := range remote.branches {
+		end := slices.IndexFunc(history, func(c fakeCommit) bool { return c.hash.equals(descendant) })
+		if end >= 0 && slices.ContainsFunc(history[:end+1], func(c fakeCommit) bool { return c.hash.equals(ancestor) }) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (f *fakeGit) resetTo(_ context.Context, repoDir string, commit digest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	remote, info, err := f.open(repoDir)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := remote.find(commit.String()); !ok {
+		return fmt.Errorf("commit %s not found", commit)
+	}
+
+	// Like git reset --hard, discard any local changes.
+	if err := os.Remove(filepath.Join(repoDir, ".git", fakeDirtyFile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return writeFakeHead(repoDir, info.branch, commit)
+}
+
+func (f *fakeGit) checkoutRef(ctx context.Context, repoDir, ref string) error {
+	hash, err := f.fetchRef(ctx, repoDir, ref)
+	if err != nil {
+		return err
+	}
+
+	return writeFakeHead(repoDir, "", hash)
+}
+
+func (f *fakeGit) fetchRef(_ context.Context, repoDir, ref string) (digest, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	remote, _, err := f.open(repoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if hash, ok := remote.tags[ref]; ok {
+		return hash, nil
+	}
+
+	if commit, ok := remote.find(ref); ok {
+		return commit.hash, nil
+	}
+
+	return nil, fmt.Errorf("cannot find commit or tag %q", ref)
+}
+
+func (f *fakeGit) sharesHistory(_ context.Context, repoDir string, a, b digest) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	remote, _, err := f.open(repoDir)
+	if err != nil {
+		return false, err
+	}
+
+	// The fake's remotes share no commits unless one mirrors another.
+	return remote.knows(a) && remote.knows(b), nil
+}
+
+func (f *fakeGit) sharesCommits(_ context.Context, repoDir, url string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	local, _, err := f.open(repoDir)
+	if err != nil {
+		return false, err
+	}
+
+	remote, ok := f.remotes[url]
+	if !ok {
+		return false, fmt.Errorf("repository %q not found", url)
+	}
+
+	for _, history := range remote.branches {
+		if len(history) > 0 && local.knows(history[len(history)-1].hash) {
+			return true, nil
+		}
+	}
+	for _, hash := range remote.tags {
+		if local.knows(hash) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (f *fakeGit) setURL(_ context.Context, repoDir, url string) error {
+	return writeFakeConfig(repoDir, url)
+}
+
+func (f *fakeGit) switchBranch(ctx context.Context, repoDir, branch string) error {
+	tip, err := f.fetch(ctx, repoDir, branch)
+	if err != nil {
+		return err
+	}
+
+	return writeFakeHead(repoDir, branch, tip)
+}
+
+func (f *fakeGit) updateSubmodules(context.Context, string) error {
+	return nil
+}
+
+func (f *fakeGit) repoURL(_ context.Context, repoDir string) (string, error) {
+	return repoURLViaFilesystem(repoDir)
+}
+
+func (f *fakeGit) getBranchInfo(_ context.Context, repoDir string) (branchInfo, error) {
+	return getBranchInfoViaFilesystem(repoDir)
+}
+
+func (f *fakeGit) tagCommit(_ context.Context, repoDir, tag string) (digest, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	remote, _, err := f.open(repoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return remote.tags[tag], nil
+}
+
+func (f *fakeGit) commitsBetween(_ context.Context, repoDir string, oldHash, newHash digest) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	remote, _, err := f.open(repoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, history := range remote.branches {
+		end := slices.IndexFunc(history, func(c fakeCommit) bool { return c.hash.equals(newHash) })
+		start := slices.IndexFunc(history, func(c fakeCommit) bool { return c.hash.equals(oldHash) })
+		if end < 0 || start < 0 || start > end {
+			continue
+		}
+
+		commits := make([]string, 0, end-start)
+		for i := end; i > start; i-- {
+			commits = append(commits, history[i].hash.short()+" "+history[i].subject)
+		}
+
+		return commits, nil
+	}
+
+	return nil, errors.New("no path between commits")
+}
+
+func (f *fakeGit) isDirty(_ context.Context, repoDir string) (bool, error) {
+	_, err := os.Stat(filepath.Join(repoDir, ".git", fakeDirtyFile))
+
+	return err == nil, nil
+}
+
+func (f *fakeGit) hasUnpushed(_ context.Context, repoDir string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	remote, info, err := f.open(repoDir)
+	if err != nil {
+		return false, err
+	}
+
+	return !remote.knows(info.hash), nil
+}
+
+// open returns the remote and current state of a clone.
+func (f *fakeGit) open(repoDir string) (*fakeRemote, branchInfo, error) {
+	url, err := repoURLViaFilesystem(repoDir)
+	if err != nil {
+		return nil, branchInfo{}, err
+	}
+
+	remote, ok := f.remotes[url]
+	if !ok {
+		return nil, branchInfo{}, fmt.Errorf("repository %q not found", url)
+	}
+
+	info, err := getBranchInfoViaFilesystem(repoDir)
+
+	return remote, info, err
+}
+
+// find returns the commit that a full or abbreviated hash names.
+func (r *fakeRemote) find(rev string) (fakeCommit, bool) {
+	for _, history := range r.branches {
+		for _, commit := range history {
+			if rev != "" && strings.HasPrefix(commit.hash.String(), rev) {
+				return commit, true
+			}
+		}
+	}
+
+	return fakeCommit{}, false
+}
+
+func (r *fakeRemote) defaultBranch() string {
+	if r.head == "" {
+		return "main"
+	}
+
+	return r.head
+}
+
+// knows reports whether a commit is or was on the remote. Clones count
+// commits that a force push dropped as pushed, as git does until the next
+// fetch.
+func (r *fakeRemote) knows(hash digest) bool {
+	_, ok := r.find(hash.String())
+
+	return ok || slices.ContainsFunc(r.dropped, func(c fakeCommit) bool { return c.hash.equals(hash) })
+}
+
+// writeFakeRepo creates a clone with just the metadata that pluggo reads.
+func writeFakeRepo(dir, url, branch string, hash digest) error {
+	if err := os.MkdirAll(filepath.Join(dir, ".git"), 0o755); err != nil {
+		return err
+	}
+	if err := writeFakeConfig(dir, url); err != nil {
+		return err
+	}
+
+	return writeFakeHead(dir, branch, hash)
+}
+
+// writeFakeConfig sets the URL of a clone's origin remote.
+func writeFakeConfig(dir, url string) error {
+	config := fmt.Sprintf("[remote \"origin\"]\n\turl = %s\n", url)
+
+	return os.WriteFile(filepath.Join(dir, ".git", "config"), []byte(config), 0o644)
+}
+
+// writeFakeHead points a clone's branch at hash, or detaches HEAD at hash if
+// branch is empty.
+func writeFakeHead(dir, branch string, hash digest) error {
+	gitDir := filepath.Join(dir, ".git")
+	if branch == "" {
+		return os.WriteFile(filepath.Join(gitDir, "HEAD"), []byte(hash.String()+"\n"), 0o644)
+	}
+
+	refFile := filepath.Join(gitDir, "refs", "heads", branch)
+	if err := os.MkdirAll(filepath.Dir(refFile), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(refFile, []byte(hash.String()+"\n"), 0o644); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(gitDir, "HEAD"), []byte("ref: refs/heads/"+branch+"\n"), 0o644)
+}
+
+// gitRemotes hosts real bare repositories in a temporary directory. Each
+// remote has a work tree next to it for making commits.
+type gitRemotes struct {
+	branches map[string]bool // "name/branch" for every branch with commits
+	root     string
+}
+
+func newGitRemotes(t *testing.T) *gitRemotes {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	return &gitRemotes{
+		branches: make(map[string]bool),
+		root:     t.TempDir(),
+	}
+}
+
+func (g *gitRemotes) backend() gitBackend {
+	return execGit{}
+}
+
+func (g *gitRemotes) url(name string) string {
+	return filepath.Join(g.root, name+".git")
+}
+
+func (g *gitRemotes) commit(t *testing.T, name, branch, subject string) {
+	t.Helper()
+
+	work := filepath.Join(g.root, name+".work")
+	switch {
+	case !g.branches[name+"/main"]:
+		// The first commit of a remote is always on main.
+		mustGit(t, g.root, "init", "--quiet", "--bare", "--initial-branch=main", g.url(name))
+		mustGit(t, g.root, "init", "--quiet", "--initial-branch=main", work)
+		mustGit(t, work, "remote", "add", "origin", g.url(name))
+	case !g.branches[name+"/"+branch]:
+		// New branches start from main.
+		mustGit(t, work, "checkout", "--quiet", "-b", branch)
+	default:
+		mustGit(t, work, "checkout", "--quiet", branch)
+	}
+	g.branches[name+"/"+branch] = true
+
+	writeFiles(t, work, map[string]string{"file.txt": subject + "\n"})
+	mustGit(t, work, "add", "file.txt")
+	mustGit(t, work, "commit", "--quiet", "-m", subject)
+	mustGit(t, work, "push", "--quiet", "origin", branch)
+	mustGit(t, work, "checkout", "--quiet", "main")
+}
+
+func (g *gitRemotes) rewrite(t *testing.T, name, branch, subject string) {
+	t.Helper()
+
+	work := filepath.Join(g.root, name+".work")
+	mustGit(t, work, "checkout", "--quiet", branch)
+	writeFiles(t, work, map[string]string{"file.txt": subject + "\n"})
+	mustGit(t, work, "commit", "--quiet", "--amend", "-a", "-m", subject)
+	mustGit(t, work, "push", "--quiet", "--force", "origin", branch)
+	mustGit(t, work, "checkout", "--quiet", "main")
+}
+
+func (g *gitRemotes) mirror(t *testing.T, name, mirrorName string) {
+	t.Helper()
+
+	mustGit(t, g.root, "clone", "--quiet", "--mirror", g.url(name), g.url(mirrorName))
+}
+
+func (g *gitRemotes) setDefault(t *testing.T, name, branch string) {
+	t.Helper()
+
+	mustGit(t, g.url(name), "symbolic-ref", "HEAD", "refs/heads/"+branch)
+}
+
+func (g *gitRemotes) tag(t *testing.T, name, tag string) {
+	t.Helper()
+
+	work := filepath.Join(g.root, name+".work")
+	mustGit(t, work, "tag", tag, "main")
+	mustGit(t, work, "push", "--quiet", "origin", tag)
+}
+
+func (g *gitRemotes) modify(t *testing.T, pluginDir string) {
+	t.Helper()
+
+	writeFiles(t, pluginDir, map[string]string{"file.txt": "local change\n"})
+}
+
+func mustGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	args = append([]string{
+		"-C", dir,
+		"-c", "user.name=pluggo",
+		"-c", "user.email=pluggo@example.com",
+		"-c", "commit.gpgSign=false",
+		"-c", "tag.gpgSign=false",
+	}, args...)
+
+	cmd := exec.CommandContext(t.Context(), "git", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s failed: %s\n%s", strings.Join(args, " "), err, output)
+	}
+}
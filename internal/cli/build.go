@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// buildError reports a failed build command along with everything it printed.
+type buildError struct {
+	err      error
+	output   []byte
+	timedOut bool
+}
+
+func (e *buildError) Error() string {
+	if e.timedOut {
+		return "build command timed out"
+	}
+
+	return "build command failed: " + e.err.Error()
+}
+
+func (e *buildError) Unwrap() error {
+	return e.err
+}
+
+// runBuild runs a plugin's build command in the plugin's directory and stops
+// it, along with anything that it started, after timeout.
+func runBuild(ctx context.Context, dir, command string, timeout duration) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout))
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = newCommand(ctx, "cmd", "/C", command)
+	} else {
+		cmd = newCommand(ctx, "sh", "-c", command)
+	}
+	cmd.Dir = dir
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return &buildError{
+			err:      err,
+			output:   output,
+			timedOut: errors.Is(ctx.Err(), context.DeadlineExceeded),
+		}
+	}
+
+	return nil
+}
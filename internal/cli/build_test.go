@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunBuildSuccess(t *testing.T) {
+	t.Parallel()
+
+	if err := runBuild(t.Context(), t.TempDir(), "echo built", defaultBuildTimeout); err != nil {
+		t.Errorf("runBuild() unexpected error: %v", err)
+	}
+}
+
+func TestRunBuildFailure(t *testing.T) {
+	t.Parallel()
+
+	err := runBuild(t.Context(), t.TempDir(), "echo oops && exit 3", defaultBuildTimeout)
+
+	var bErr *buildError
+	if !errors.As(err, &bErr) {
+		t.Fatalf("runBuild() error = %v; want *buildError", err)
+	}
+
+	if !strings.Contains(string(bErr.output), "oops") {
+		t.Errorf("runBuild() output = %q; want it to contain %q", bErr.output, "oops")
+	}
+}
+
+func TestRunBuildTimeout(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("cmd has no sleep command")
+	}
+
+	start := time.Now()
+	err := runBuild(t.Context(), t.TempDir(), "sleep 10; true", duration(100*time.Millisecond))
+
+	var bErr *buildError
+	if !errors.As(err, &bErr) || !bErr.timedOut {
+		t.Fatalf("runBuild() error = %v; want a *buildError that timed out", err)
+	}
+
+	if elapsed := time.Since(start); elapsed >= waitDelay {
+		t.Errorf("runBuild() returned after %s; want less than %s", elapsed, waitDelay)
+	}
+}
@@ -5,47 +5,106 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/telemachus/opts"
 )
 
+const (
+	defaultJobs   = 15
+	defaultSubcmd = "sync"
+	formatText    = "text"
+	formatJSON    = "json"
+)
+
+var subcmds = []string{"sync", "install", "update", "clean", "status", "list", "validate", "check-config"}
+
 type cmdEnv struct {
-	homeDir       string
-	name          string
-	version       string
-	confFile      string
-	dataDir       string
-	startDir      string
-	optDir        string
-	results       []result
-	warnings      atomic.Uint64
-	debugWanted   bool
-	helpWanted    bool
-	quietWanted   bool
-	versionWanted bool
+	git             gitBackend
+	locked          map[string]lockEntry
+	homeDir         string
+	name            string
+	version         string
+	subcmd          string
+	format          string
+	confFile        string
+	lockFile        string
+	dataDir         string
+	startDir        string
+	optDir          string
+	stagingDir      string
+	urlTemplate     string
+	keep            []string
+	stripPrefixes   []string
+	results         []result
+	timeouts        timeouts
+	backoff         time.Duration
+	attempts        int
+	jobs            int
+	warnings        atomic.Uint64
+	debugWanted     bool
+	changelogWanted bool
+	dryRunWanted    bool
+	forceWanted     bool
+	helpWanted      bool
+	quietWanted     bool
+	restoreWanted   bool
+	versionWanted   bool
 }
 
 func cmdFrom(name, version string, args []string) (*cmdEnv, error) {
 	cmd := &cmdEnv{
 		name:    name,
 		version: version,
+		git:     execGit{},
+		backoff: retryBackoff,
 	}
 
+	// Options may appear before or after the command, so define both groups
+	// before parsing either. (Defining an option resets it to its default.)
 	og := opts.NewGroup(cmd.name)
-	og.String(&cmd.confFile, "config", "")
-	og.Bool(&cmd.debugWanted, "debug")
-	og.Bool(&cmd.helpWanted, "help")
-	og.Bool(&cmd.helpWanted, "h")
-	og.Bool(&cmd.quietWanted, "quiet")
-	og.Bool(&cmd.versionWanted, "version")
-	og.Bool(&cmd.versionWanted, "V")
+	cmd.defineOpts(og)
+	sg := opts.NewGroup(cmd.name)
+	cmd.defineOpts(sg)
 
-	if err := og.Parse(args); err != nil {
+	rest, err := og.ParseKnown(args)
+	if err != nil {
 		return nil, fmt.Errorf("argument parsing error: %w", err)
 	}
 
+	cmd.subcmd = defaultSubcmd
+	if len(rest) > 0 {
+		cmd.subcmd = rest[0]
+		if !slices.Contains(subcmds, cmd.subcmd) {
+			return nil, fmt.Errorf("unknown command %q", cmd.subcmd)
+		}
+
+		if err := sg.Parse(rest[1:]); err != nil {
+			return nil, fmt.Errorf("argument parsing error: %w", err)
+		}
+	}
+	if cmd.subcmd == "check-config" {
+		cmd.subcmd = "validate"
+	}
+
+	if cmd.jobs < 1 {
+		return nil, fmt.Errorf("invalid number of jobs %d: must be at least 1", cmd.jobs)
+	}
+
+	if cmd.format != formatText && cmd.format != formatJSON {
+		return nil, fmt.Errorf("unknown format %q: use %q or %q", cmd.format, formatText, formatJSON)
+	}
+
+	// These commands print only text.
+	if cmd.format == formatJSON && (cmd.subcmd == "status" || cmd.subcmd == "list") {
+		return nil, fmt.Errorf("the %s command does not support --format=%s", cmd.subcmd, formatJSON)
+	}
+
 	// Return early (and without error) for help or version.
 	if cmd.helpWanted {
 		fmt.Print(cmdUsage)
@@ -63,14 +122,31 @@ func cmdFrom(name, version string, args []string) (*cmdEnv, error) {
 	}
 	cmd.homeDir = homeDir
 
-	// Set default config if user hasn't specified their own.
+	// Look for a config if user hasn't specified their own.
 	if cmd.confFile == "" {
-		cmd.confFile = filepath.Join(cmd.homeDir, confFile)
+		cmd.confFile = findConfig(cmd.homeDir, os.LookupEnv)
 	}
+	cmd.lockFile = lockPath(cmd.confFile)
 
 	return cmd, nil
 }
 
+func (cmd *cmdEnv) defineOpts(og *opts.Group) {
+	og.String(&cmd.confFile, "config", "")
+	og.String(&cmd.format, "format", formatText)
+	og.Int(&cmd.jobs, "jobs", defaultJobs)
+	og.Bool(&cmd.changelogWanted, "changelog")
+	og.Bool(&cmd.debugWanted, "debug")
+	og.Bool(&cmd.dryRunWanted, "dry-run")
+	og.Bool(&cmd.forceWanted, "force")
+	og.Bool(&cmd.helpWanted, "help")
+	og.Bool(&cmd.helpWanted, "h")
+	og.Bool(&cmd.quietWanted, "quiet")
+	og.Bool(&cmd.restoreWanted, "restore")
+	og.Bool(&cmd.versionWanted, "version")
+	og.Bool(&cmd.versionWanted, "V")
+}
+
 func (cmd *cmdEnv) plugins() ([]pluginSpec, error) {
 	cfg, err := cmd.loadConfig()
 	if err != nil {
@@ -81,12 +157,21 @@ func (cmd *cmdEnv) plugins() ([]pluginSpec, error) {
 		return nil, err
 	}
 
-	return cmd.filterPlugins(cfg.Plugins), nil
+	if err := cmd.setupSettings(cfg); err != nil {
+		return nil, err
+	}
+
+	return cmd.filterPlugins(cfg.Plugins)
 }
 
 type config struct {
-	Plugins []pluginSpec `json:"plugins"`
-	DataDir []string     `json:"dataDir"`
+	URLTemplate   string       `json:"urlTemplate"`
+	Plugins       []pluginSpec `json:"plugins"`
+	DataDir       []string     `json:"dataDir"`
+	Keep          []string     `json:"keep"`
+	StripPrefixes []string     `json:"stripPrefixes"`
+	Timeout       timeouts     `json:"timeout"`
+	Attempts      int          `json:"attempts"`
 }
 
 func (cmd *cmdEnv) loadConfig() (config, error) {
@@ -97,7 +182,18 @@ func (cmd *cmdEnv) loadConfig() (config, error) {
 		return cfg, fmt.Errorf("cannot read config %q: %w", cmd.confFile, err)
 	}
 
-	if err := json.Unmarshal(conf, &cfg); err != nil {
+	root, err := parseConfig(cmd.confFile, conf)
+	if err != nil {
+		var syntaxErr *configSyntaxError
+		if errors.As(err, &syntaxErr) {
+			line, col := position(conf, syntaxErr.offset)
+			return cfg, fmt.Errorf("cannot parse config %q at line %d, column %d: %w", cmd.confFile, line, col, err)
+		}
+
+		return cfg, fmt.Errorf("cannot parse config %q: %w", cmd.confFile, err)
+	}
+
+	if err := json.Unmarshal(root.raw, &cfg); err != nil {
 		return cfg, fmt.Errorf("cannot parse config %q: %w", cmd.confFile, err)
 	}
 
@@ -110,21 +206,68 @@ func (cmd *cmdEnv) setupDirs(dataDirParts []string) error {
 		dataDirParts[0] = cmd.homeDir
 	}
 
-	cmd.dataDir = filepath.Join(dataDirParts...)
+	dataDir, err := expandPath(filepath.Join(dataDirParts...), cmd.homeDir, os.LookupEnv)
+	if err != nil {
+		return fmt.Errorf("cannot expand dataDir: %w", err)
+	}
+
+	cmd.dataDir = dataDir
 	if cmd.dataDir == "" {
 		return errors.New("dataDir is required in configuration")
 	}
 
 	cmd.startDir = filepath.Join(cmd.dataDir, "start")
 	cmd.optDir = filepath.Join(cmd.dataDir, "opt")
+	// Vim only looks in start/ and opt/, so it never sees half-finished clones.
+	cmd.stagingDir = filepath.Join(cmd.dataDir, ".staging")
 
 	return nil
 }
 
-// filterPlugins drops any plugins that lack a name, URL, or branch.
-func (cmd *cmdEnv) filterPlugins(plugins []pluginSpec) []pluginSpec {
+// setupSettings checks and stores the config's settings other than plugins
+// and dataDir.
+func (cmd *cmdEnv) setupSettings(cfg config) error {
+	for _, pattern := range cfg.Keep {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid keep pattern %q: %w", pattern, err)
+		}
+	}
+	cmd.keep = cfg.Keep
+	cmd.timeouts = cfg.Timeout
+
+	cmd.attempts = defaultAttempts
+	if cfg.Attempts != 0 {
+		if cfg.Attempts < 1 {
+			return fmt.Errorf("invalid attempts %d: must be at least 1", cfg.Attempts)
+		}
+		cmd.attempts = cfg.Attempts
+	}
+
+	cmd.urlTemplate = defaultURLTemplate
+	if cfg.URLTemplate != "" {
+		if !strings.Contains(cfg.URLTemplate, urlPlaceholder) {
+			return fmt.Errorf("invalid urlTemplate %q: must contain %s", cfg.URLTemplate, urlPlaceholder)
+		}
+		cmd.urlTemplate = cfg.URLTemplate
+	}
+	cmd.stripPrefixes = cfg.StripPrefixes
+
+	return nil
+}
+
+// filterPlugins expands shorthand URLs and fills in missing names from URLs.
+// It drops any plugins that lack a URL or a name that can be derived from it
+// and any plugins whose names are not safe to use as directory names. A plugin
+// pinned to both a commit and a tag is an error, since dropping it would let
+// sync remove the copy that is installed.
+func (cmd *cmdEnv) filterPlugins(plugins []pluginSpec) ([]pluginSpec, error) {
 	i := 0
 	for _, pSpec := range plugins {
+		pSpec.URL = expandURL(pSpec.URL, cmd.urlTemplate)
+		if pSpec.Name == "" {
+			pSpec.Name = nameFromURL(pSpec.URL, cmd.stripPrefixes)
+		}
+
 		if pSpec.Name == "" {
 			if pSpec.URL != "" {
 				fmt.Fprintf(os.Stderr, "%s: skipping plugin with URL %q: missing name\n", cmd.name, pSpec.URL)
@@ -141,17 +284,21 @@ func (cmd *cmdEnv) filterPlugins(plugins []pluginSpec) []pluginSpec {
 			continue
 		}
 
-		if pSpec.Branch == "" {
-			fmt.Fprintf(os.Stderr, "%s: skipping plugin %q: missing branch\n", cmd.name, pSpec.Name)
+		if err := checkName(pSpec.Name); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: skipping plugin with URL %q: %s\n", cmd.name, pSpec.URL, err)
 
 			continue
 		}
 
+		if pSpec.Commit != "" && pSpec.Tag != "" {
+			return nil, fmt.Errorf("plugin %q has both a commit and a tag; use one or the other", pSpec.Name)
+		}
+
 		plugins[i] = pSpec
 		i++
 	}
 
-	return plugins[:i]
+	return plugins[:i], nil
 }
 
 // pluginPath returns the full path where a plugin should be installed.
@@ -163,6 +310,14 @@ func (cmd *cmdEnv) pluginPath(pSpec pluginSpec) string {
 	return filepath.Join(cmd.startDir, pSpec.Name)
 }
 
+// debugf displays low-level details in debug mode without counting them as
+// failures.
+func (cmd *cmdEnv) debugf(format string, args ...any) {
+	if cmd.debugWanted {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+	}
+}
+
 // warnf counts non-fatal failures and, in debug mode, displays them too.
 func (cmd *cmdEnv) warnf(format string, args ...any) {
 	cmd.warnings.Add(1)
@@ -171,12 +326,34 @@ func (cmd *cmdEnv) warnf(format string, args ...any) {
 	}
 }
 
-var cmdUsage = `usage: pluggo [options]
+var cmdUsage = `usage: pluggo [options] [command] [options]
 
 Manage Vim or Neovim plugins
 
+Commands:
+  sync		Install, reinstall, move, update, and remove plugins
+			as needed to match the config (default)
+  install	Install plugins that are missing
+  update	Update installed plugins that are not pinned
+  clean		Remove installed plugins that are not in the config
+  status	Compare installed plugins with the config
+  list		List plugins in the config
+  validate	Check the config and report every problem in it
+			(alias: check-config)
+
 Options:
-      --config=FILE	Use FILE as config file (default ~/.pluggo.json)
+      --config=FILE	Use FILE as config file (default $PLUGGO_CONFIG,
+			then config.json, config.jsonc, or config.toml in
+			$XDG_CONFIG_HOME/pluggo/, then ~/.pluggo.json)
+      --restore		Check out the commits recorded in the lockfile
+			instead of updating plugins
+      --dry-run		Print planned actions without changing anything
+      --force		Update, reinstall, or remove plugins even if they
+			have uncommitted changes or unpushed commits
+      --changelog	List the commits pulled in for each updated plugin
+      --format=FORMAT	Print results as "text" (default) or "json"
+			(not for status or list)
+      --jobs=N		Process at most N plugins at once (default 15)
       --quiet		Print only error messages
       --debug		Print additional low-level error messages
 
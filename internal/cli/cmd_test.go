@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"testing"
+)
+
+func TestCmdFromSubcommand(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		expected string
+		args     []string
+		quiet    bool
+	}{
+		"no command":            {args: []string{}, expected: "sync"},
+		"options only":          {args: []string{"--quiet"}, expected: "sync", quiet: true},
+		"command only":          {args: []string{"install"}, expected: "install"},
+		"options before":        {args: []string{"--quiet", "update"}, expected: "update", quiet: true},
+		"options after":         {args: []string{"clean", "--quiet"}, expected: "clean", quiet: true},
+		"config before command": {args: []string{"--config=x.json", "status"}, expected: "status"},
+		"check-config alias":    {args: []string{"check-config"}, expected: "validate"},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			cmd, err := cmdFrom("test", "v0", tc.args)
+			if err != nil {
+				t.Fatalf("cmdFrom(%q) failed: %v", tc.args, err)
+			}
+
+			if cmd.subcmd != tc.expected {
+				t.Errorf("cmdFrom(%q).subcmd = %q; want %q", tc.args, cmd.subcmd, tc.expected)
+			}
+
+			if cmd.quietWanted != tc.quiet {
+				t.Errorf("cmdFrom(%q).quietWanted = %t; want %t", tc.args, cmd.quietWanted, tc.quiet)
+			}
+		})
+	}
+}
+
+func TestCmdFromSubcommandErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string][]string{
+		"unknown command":       {"frobnicate"},
+		"extra arguments":       {"sync", "extra"},
+		"unknown option after":  {"sync", "--nope"},
+		"unknown option before": {"--nope", "sync"},
+		"json status":           {"--format=json", "status"},
+		"json list":             {"list", "--format=json"},
+	}
+
+	for msg, args := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := cmdFrom("test", "v0", args); err == nil {
+				t.Errorf("cmdFrom(%q) expected error", args)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// xdgDefaults are the XDG base directories, relative to HOME, to use when
+// their variables are not set.
+var xdgDefaults = map[string]string{
+	"XDG_CONFIG_HOME": ".config",
+	"XDG_DATA_HOME":   filepath.Join(".local", "share"),
+}
+
+// configNames are the files that findConfig looks for in the XDG config
+// directory, in order.
+var configNames = []string{"config.json", "config.jsonc", "config.toml"}
+
+// findConfig returns the config file to use if --config is not given. It
+// tries $PLUGGO_CONFIG, then each of configNames in $XDG_CONFIG_HOME/pluggo/,
+// and then ~/.pluggo.json. If none of these exist, findConfig returns
+// ~/.pluggo.json so that the error names the traditional location.
+func findConfig(homeDir string, lookupEnv func(string) (string, bool)) string {
+	if path, ok := lookupEnv("PLUGGO_CONFIG"); ok && path != "" {
+		return path
+	}
+
+	configHome, ok := lookupEnv("XDG_CONFIG_HOME")
+	// The XDG spec says to ignore relative paths.
+	if !ok || !filepath.IsAbs(configHome) {
+		configHome = filepath.Join(homeDir, xdgDefaults["XDG_CONFIG_HOME"])
+	}
+	for _, name := range configNames {
+		path := filepath.Join(configHome, "pluggo", name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	return filepath.Join(homeDir, confFile)
+}
+
+// expandPath replaces a leading ~ with the home directory and $VAR or ${VAR}
+// with the value of VAR, and then cleans the result. XDG_CONFIG_HOME and
+// XDG_DATA_HOME fall back to their defaults, but any other variable must be
+// set.
+func expandPath(path, homeDir string, lookupEnv func(string) (string, bool)) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		path = homeDir + path[1:]
+	}
+
+	var missing string
+	path = os.Expand(path, func(name string) string {
+		if value, ok := lookupEnv(name); ok && value != "" {
+			return value
+		}
+		if dir, ok := xdgDefaults[name]; ok {
+			return filepath.Join(homeDir, dir)
+		}
+		if missing == "" {
+			missing = name
+		}
+
+		return ""
+	})
+	if missing != "" {
+		return "", fmt.Errorf("$%s is not set", missing)
+	}
+
+	if path == "" {
+		return "", nil
+	}
+
+	return filepath.Clean(path), nil
+}
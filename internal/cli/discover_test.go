@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func fakeLookupEnv(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func TestFindConfig(t *testing.T) {
+	t.Parallel()
+
+	home := t.TempDir()
+	xdgConfig := t.TempDir()
+	for _, dir := range []string{filepath.Join(home, ".config", "pluggo"), filepath.Join(xdgConfig, "pluggo")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("test cannot finish since os.MkdirAll(%q) failed: %v", dir, err)
+		}
+	}
+	for _, path := range []string{filepath.Join(home, ".config", "pluggo", "config.json"), filepath.Join(xdgConfig, "pluggo", "config.toml")} {
+		if err := os.WriteFile(path, []byte("{}"), 0o644); err != nil {
+			t.Fatalf("test cannot finish since os.WriteFile(%q) failed: %v", path, err)
+		}
+	}
+	empty := t.TempDir()
+
+	tests := map[string]struct {
+		homeDir  string
+		env      map[string]string
+		expected string
+	}{
+		"PLUGGO_CONFIG": {
+			homeDir:  home,
+			env:      map[string]string{"PLUGGO_CONFIG": filepath.FromSlash("/etc/pluggo.toml"), "XDG_CONFIG_HOME": xdgConfig},
+			expected: filepath.FromSlash("/etc/pluggo.toml"),
+		},
+		"XDG_CONFIG_HOME": {
+			homeDir:  home,
+			env:      map[string]string{"XDG_CONFIG_HOME": xdgConfig},
+			expected: filepath.Join(xdgConfig, "pluggo", "config.toml"),
+		},
+		"default XDG_CONFIG_HOME": {
+			homeDir:  home,
+			env:      map[string]string{},
+			expected: filepath.Join(home, ".config", "pluggo", "config.json"),
+		},
+		"relative XDG_CONFIG_HOME": {
+			homeDir:  home,
+			env:      map[string]string{"XDG_CONFIG_HOME": "config"},
+			expected: filepath.Join(home, ".config", "pluggo", "config.json"),
+		},
+		"home dotfile": {
+			homeDir:  empty,
+			env:      map[string]string{"PLUGGO_CONFIG": ""},
+			expected: filepath.Join(empty, ".pluggo.json"),
+		},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := findConfig(tc.homeDir, fakeLookupEnv(tc.env)); actual != tc.expected {
+				t.Errorf("findConfig(%q) = %q; want %q", tc.homeDir, actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	t.Parallel()
+
+	lookupEnv := fakeLookupEnv(map[string]string{
+		"PACK":          "/srv/pack/",
+		"XDG_DATA_HOME": "/data",
+	})
+	tests := map[string]struct {
+		path     string
+		expected string
+	}{
+		"plain":           {path: "/a/b", expected: "/a/b"},
+		"tilde":           {path: "~", expected: "/home/u"},
+		"tilde slash":     {path: "~/pack", expected: "/home/u/pack"},
+		"tilde user":      {path: "~other/pack", expected: "~other/pack"},
+		"variable":        {path: "$XDG_DATA_HOME/nvim/site/pack", expected: "/data/nvim/site/pack"},
+		"braces":          {path: "${PACK}pluggo", expected: "/srv/pack/pluggo"},
+		"default XDG":     {path: "$XDG_CONFIG_HOME/pluggo", expected: "/home/u/.config/pluggo"},
+		"tilde in middle": {path: "/a/~/b", expected: "/a/~/b"},
+		"empty":           {path: "", expected: ""},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := expandPath(tc.path, "/home/u", lookupEnv)
+			if err != nil {
+				t.Fatalf("expandPath(%q) failed: %v", tc.path, err)
+			}
+
+			// expandPath cleans paths, which uses backslashes on Windows.
+			if expected := filepath.FromSlash(tc.expected); actual != expected {
+				t.Errorf("expandPath(%q) = %q; want %q", tc.path, actual, expected)
+			}
+		})
+	}
+}
+
+func TestExpandPathErrors(t *testing.T) {
+	t.Parallel()
+
+	lookupEnv := fakeLookupEnv(map[string]string{"EMPTY": ""})
+	for _, path := range []string{"$NOPE/pack", "${EMPTY}/pack"} {
+		if _, err := expandPath(path, "/home/u", lookupEnv); err == nil {
+			t.Errorf("expandPath(%q) expected error", path)
+		}
+	}
+}
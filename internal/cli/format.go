@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// parseConfig parses a config file, choosing the parser by the file's
+// extension: .toml for TOML, .jsonc for JSON with comments and trailing
+// commas, and anything else for JSON.
+func parseConfig(confFile string, data []byte) (*jsonValue, error) {
+	switch strings.ToLower(filepath.Ext(confFile)) {
+	case ".toml":
+		return parseTOML(data)
+	case ".jsonc":
+		return parseJSON(stripJSONC(data))
+	default:
+		return parseJSON(data)
+	}
+}
+
+// stripJSONC turns JSON with comments and trailing commas into JSON. It
+// replaces comments and trailing commas with spaces, so that every other byte
+// keeps its offset, line, and column.
+func stripJSONC(data []byte) []byte {
+	out := make([]byte, len(data))
+	copy(out, data)
+
+	blank := func(from, to int) {
+		for i := from; i < to; i++ {
+			if out[i] != '\n' {
+				out[i] = ' '
+			}
+		}
+	}
+
+	// First, remove comments.
+	for i := 0; i < len(out); i++ {
+		switch {
+		case out[i] == '"':
+			i = skipString(out, i)
+		case out[i] == '/' && i+1 < len(out) && out[i+1] == '/':
+			end := i
+			for end < len(out) && out[end] != '\n' {
+				end++
+			}
+			blank(i, end)
+			i = end
+		case out[i] == '/' && i+1 < len(out) && out[i+1] == '*':
+			end := len(out)
+			if j := strings.Index(string(out[i+2:]), "*/"); j >= 0 {
+				end = i + 2 + j + 2
+			}
+			blank(i, end)
+			i = end - 1
+		}
+	}
+
+	// Then, remove commas that come right before a closing bracket or brace.
+	for i := 0; i < len(out); i++ {
+		switch out[i] {
+		case '"':
+			i = skipString(out, i)
+		case ',':
+			next := i + 1
+			for next < len(out) && strings.IndexByte(" \t\r\n", out[next]) >= 0 {
+				next++
+			}
+			if next < len(out) && (out[next] == ']' || out[next] == '}') {
+				out[i] = ' '
+			}
+		}
+	}
+
+	return out
+}
+
+// skipString returns the offset of the quote that ends the string starting
+// at data[start] or the last offset in data if the string never ends.
+func skipString(data []byte, start int) int {
+	for i := start + 1; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+
+	return len(data) - 1
+}
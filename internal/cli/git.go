@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -14,12 +15,24 @@ import (
 
 // Git command operations
 
-func repoURL(ctx context.Context, repoDir string) (string, error) {
-	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+// execGit is the gitBackend that runs the git command.
+type execGit struct{}
+
+// repoURL returns the URL of a repository's origin remote.
+func (execGit) repoURL(ctx context.Context, repoDir string) (string, error) {
+	// Try the filesystem first since it's far faster and usually works.
+	if url, err := repoURLViaFilesystem(repoDir); err == nil {
+		return url, nil
+	}
+
+	return repoURLViaGit(ctx, repoDir)
+}
+
+func repoURLViaGit(ctx context.Context, repoDir string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "ls-remote", "--get-url")
-	output, err := cmd.Output()
+	output, err := gitOutput(ctx, "git ls-remote", "-C", repoDir, "ls-remote", "--get-url")
 	if err != nil {
 		return "", fmt.Errorf("failed to get repository URL: %w", err)
 	}
@@ -37,33 +50,291 @@ func isRepo(dir string) bool {
 	return info.IsDir() || info.Mode().IsRegular()
 }
 
-func clone(ctx context.Context, url, branch, destDir string) error {
-	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+// clone clones url into destDir. The branch may also be a tag, and if branch is
+// empty, git checks out the remote's default branch.
+func (execGit) clone(ctx context.Context, url, branch, destDir string) error {
+	args := []string{"clone", "--filter=blob:none"}
+	if branch != "" {
+		args = append(args, "-b", branch)
+	}
+	args = append(args, url, destDir)
+
+	return runGit(ctx, "git clone", args...)
+}
+
+// fetch updates origin's copy of branch, even if the branch was force-pushed,
+// and returns the commit at its tip.
+func (execGit) fetch(ctx context.Context, repoDir, branch string) (digest, error) {
+	tracking := "refs/remotes/origin/" + branch
+	refspec := "+refs/heads/" + branch + ":" + tracking
+	if err := runGit(ctx, "git fetch", "-C", repoDir, "fetch", "--quiet", "origin", refspec); err != nil {
+		return nil, err
+	}
+
+	output, err := gitOutput(ctx, "git rev-parse", "-C", repoDir, "rev-parse", "--verify", "--quiet", tracking+"^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("cannot find fetched branch %q: %w", branch, err)
+	}
+
+	return digest(bytes.TrimSpace(output)), nil
+}
+
+// defaultBranch asks the remote which branch its HEAD points to.
+func (execGit) defaultBranch(ctx context.Context, repoDir string) (string, error) {
+	output, err := gitOutput(ctx, "git ls-remote", "-C", repoDir, "ls-remote", "--symref", "origin", "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	// The symref comes first: "ref: refs/heads/main\tHEAD".
+	for line := range strings.SplitSeq(string(output), "\n") {
+		target, ok := strings.CutPrefix(line, "ref: refs/heads/")
+		if !ok {
+			continue
+		}
+
+		if branch, _, ok := strings.Cut(target, "\t"); ok && branch != "" {
+			return branch, nil
+		}
+	}
+
+	return "", errors.New("remote has no default branch")
+}
+
+// isAncestor reports whether ancestor is reachable from descendant.
+func (execGit) isAncestor(ctx context.Context, repoDir string, ancestor, descendant digest) (bool, error) {
+	err := runGit(ctx, "git merge-base", "-C", repoDir, "merge-base", "--is-ancestor", ancestor.String(), descendant.String())
+
+	return gitAnswer(err)
+}
+
+// gitAnswer interprets the error from a git command that answers a question
+// with its exit status: 0 for yes, 1 for no, and more for errors.
+func gitAnswer(err error) (bool, error) {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// resetTo moves the checked-out branch of a repository to commit, fetching
+// from the remote first if the commit is not yet available locally.
+func (execGit) resetTo(ctx context.Context, repoDir string, commit digest) error {
+	if !hasCommit(ctx, repoDir, commit.String()) {
+		if err := runGit(ctx, "git fetch", "-C", repoDir, "fetch", "origin"); err != nil {
+			return err
+		}
+	}
+
+	return runGit(ctx, "git reset", "-C", repoDir, "reset", "--quiet", "--hard", commit.String())
+}
+
+// checkoutRef fetches from the remote and detaches HEAD at a commit or tag.
+func (g execGit) checkoutRef(ctx context.Context, repoDir, ref string) error {
+	if _, err := g.fetchRef(ctx, repoDir, ref); err != nil {
+		return err
+	}
+
+	return runGit(ctx, "git checkout", "-C", repoDir, "checkout", "--quiet", "--detach", ref+"^{commit}")
+}
+
+// fetchRef fetches branches and tags from the remote and returns the commit
+// that a commit or tag names.
+func (execGit) fetchRef(ctx context.Context, repoDir, ref string) (digest, error) {
+	// The remote's tags win, since a tag may have been moved upstream.
+	if err := runGit(ctx, "git fetch", "-C", repoDir, "fetch", "--tags", "--force", "origin"); err != nil {
+		return nil, err
+	}
+
+	// A commit that no branch or tag reaches must be fetched by name.
+	if !hasCommit(ctx, repoDir, ref) {
+		if err := runGit(ctx, "git fetch", "-C", repoDir, "fetch", "origin", ref); err != nil {
+			return nil, fmt.Errorf("cannot find commit or tag %q: %w", ref, err)
+		}
+	}
+
+	output, err := gitOutput(ctx, "git rev-parse", "-C", repoDir, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("cannot find commit or tag %q: %w", ref, err)
+	}
+
+	return digest(bytes.TrimSpace(output)), nil
+}
+
+// sharesHistory reports whether two commits have a common ancestor.
+func (execGit) sharesHistory(ctx context.Context, repoDir string, a, b digest) (bool, error) {
+	err := runGit(ctx, "git merge-base", "-C", repoDir, "merge-base", a.String(), b.String())
+
+	return gitAnswer(err)
+}
+
+// sharesCommits compares the branches and tags that the repository at url
+// advertises with the local refs, including HEAD and peeled tags.
+func (execGit) sharesCommits(ctx context.Context, repoDir, url string) (bool, error) {
+	remote, err := gitOutput(ctx, "git ls-remote", "-C", repoDir, "ls-remote", "--heads", "--tags", url)
+	if err != nil {
+		return false, err
+	}
+
+	local, err := gitOutput(ctx, "git show-ref", "-C", repoDir, "show-ref", "--head", "--dereference")
+	if err != nil {
+		return false, err
+	}
+
+	hashes := make(map[string]bool)
+	for line := range strings.Lines(string(local)) {
+		hash, _, _ := strings.Cut(line, " ")
+		hashes[hash] = true
+	}
+
+	for line := range strings.Lines(string(remote)) {
+		if hash, _, _ := strings.Cut(line, "\t"); hashes[hash] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// setURL changes the URL of the origin remote.
+func (execGit) setURL(ctx context.Context, repoDir, url string) error {
+	return runGit(ctx, "git remote", "-C", repoDir, "remote", "set-url", "origin", url)
+}
+
+// switchBranch checks out branch at the tip of origin's copy of it, as last
+// fetched, discarding any local changes. The branch tracks origin's copy, so
+// that git pull works in the plugin as usual.
+func (execGit) switchBranch(ctx context.Context, repoDir, branch string) error {
+	return runGit(ctx, "git checkout", "-C", repoDir, "checkout", "--quiet", "--force",
+		"-B", branch, "--track", "origin/"+branch)
+}
+
+// updateSubmodules brings submodules, including nested ones, in line with the
+// checked-out commit. It first copies any changed submodule URLs from
+// .gitmodules into the repository's config, and it discards local changes to
+// submodules. It does nothing if the repository has no submodules.
+func (execGit) updateSubmodules(ctx context.Context, repoDir string) error {
+	if _, err := os.Stat(filepath.Join(repoDir, ".gitmodules")); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err := runGit(ctx, "git submodule sync", "-C", repoDir, "submodule", "sync", "--quiet", "--recursive"); err != nil {
+		return err
+	}
+
+	return runGit(ctx, "git submodule update", "-C", repoDir, "submodule", "update", "--quiet", "--init", "--recursive", "--force")
+}
+
+// hasCommit reports whether rev names a commit that exists locally.
+func hasCommit(ctx context.Context, repoDir, rev string) bool {
+	return runGit(ctx, "git cat-file", "-C", repoDir, "cat-file", "-e", rev+"^{commit}") == nil
+}
+
+// commitsBetween returns one-line summaries of the commits that newHash has
+// but oldHash does not, newest first.
+func (execGit) commitsBetween(ctx context.Context, repoDir string, oldHash, newHash digest) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "git", "clone", "--filter=blob:none", "-b", branch, url, destDir)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("git clone failed: %w", err)
+	revRange := oldHash.String() + ".." + newHash.String()
+	output, err := gitOutput(ctx, "git log", "-C", repoDir, "log", "--no-decorate", "--format=%h %s", revRange)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commits: %w", err)
+	}
+
+	trimmed := strings.TrimSpace(string(output))
+	if trimmed == "" {
+		return nil, nil
 	}
 
-	return nil
+	return strings.Split(trimmed, "\n"), nil
 }
 
-func pull(ctx context.Context, repoDir string) error {
-	ctx, cancel := context.WithTimeout(ctx, 1*time.Minute)
+// tagCommit returns the commit that a tag names, or nil if the repository has
+// no such tag.
+func (execGit) tagCommit(ctx context.Context, repoDir, tag string) (digest, error) {
+	// Try the filesystem first, as getBranchInfo does.
+	commit, err := tagCommitViaFilesystem(repoDir, tag)
+	if err == nil {
+		return commit, nil
+	}
+
+	return tagCommitViaGit(ctx, repoDir, tag)
+}
+
+// tagCommitViaFilesystem resolves a tag and peels it to a commit without
+// running git. It reads loose and packed refs and objects.
+func tagCommitViaFilesystem(repoDir, tag string) (digest, error) {
+	dirs, err := findGitDirs(repoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := resolveRef(dirs.commonDir, "refs/tags/"+tag)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return peelToCommit(dirs.commonDir, hash)
+}
+
+func tagCommitViaGit(ctx context.Context, repoDir, tag string) (digest, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "pull", "--recurse-submodules")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("git pull failed: %w", err)
+	output, err := gitOutput(ctx, "git rev-parse", "-C", repoDir, "rev-parse", "--verify", "--quiet", "refs/tags/"+tag+"^{commit}")
+	if found, err := gitAnswer(err); !found {
+		return nil, err
 	}
 
-	return nil
+	return checkDigest(bytes.TrimSpace(output))
 }
 
-// Git metadata operations
+// isDirty reports whether a repository has uncommitted changes to tracked
+// files. Untracked files are ignored since build commands often leave them
+// behind. So are changes to doc/tags*, which pluggo itself regenerates.
+func (execGit) isDirty(ctx context.Context, repoDir string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
 
-var errDetachedHead = errors.New("repository is in detached HEAD state")
+	output, err := gitOutput(ctx, "git status", "-C", repoDir, "status", "--porcelain", "--untracked-files=no",
+		"--", ".", ":(exclude)doc/tags*")
+	if err != nil {
+		return false, fmt.Errorf("failed to check worktree: %w", err)
+	}
+
+	return len(bytes.TrimSpace(output)) > 0, nil
+}
+
+// hasUnpushed reports whether HEAD has commits that no remote branch or tag
+// contains.
+func (execGit) hasUnpushed(ctx context.Context, repoDir string) (bool, error) {
+	// Most plugins sit at the tip of origin's copy of their branch, which the
+	// filesystem shows without running git.
+	if atTrackingTip(repoDir) {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	output, err := gitOutput(ctx, "git rev-list", "-C", repoDir, "rev-list", "--max-count=1", "HEAD", "--not", "--remotes", "--tags")
+	if err != nil {
+		return false, fmt.Errorf("failed to check for unpushed commits: %w", err)
+	}
+
+	return len(bytes.TrimSpace(output)) > 0, nil
+}
+
+// Git metadata operations
 
 // digest represents a git commit SHA-1 hash.
 type digest []byte
@@ -76,13 +347,22 @@ func (d digest) String() string {
 	return string(d)
 }
 
+// short returns the abbreviated form of a digest that git itself displays.
+func (d digest) short() string {
+	if len(d) < 7 {
+		return string(d)
+	}
+
+	return string(d[:7])
+}
+
 type branchInfo struct {
-	branch string
+	branch string // "" if HEAD is detached
 	hash   digest
 }
 
 // getBranchInfo returns the branch name and SHA digest of a git repository.
-func getBranchInfo(ctx context.Context, repoDir string) (branchInfo, error) {
+func (execGit) getBranchInfo(ctx context.Context, repoDir string) (branchInfo, error) {
 	// Try the filesystem first since it's far faster and usually works.
 	info, err := getBranchInfoViaFilesystem(repoDir)
 	if err == nil {
@@ -93,24 +373,34 @@ func getBranchInfo(ctx context.Context, repoDir string) (branchInfo, error) {
 	return getBranchInfoViaGit(ctx, repoDir)
 }
 
+// getBranchInfoViaFilesystem reads HEAD and the branch it points to without
+// running git. It handles loose refs, packed refs, and .git files.
 func getBranchInfoViaFilesystem(repoDir string) (branchInfo, error) {
 	var info branchInfo
 
-	branchRef, err := getBranchRef(repoDir)
+	dirs, err := findGitDirs(repoDir)
 	if err != nil {
 		return info, err
 	}
 
-	info.branch = strings.TrimPrefix(branchRef, "refs/heads/")
-
-	branchRefFile := filepath.Join(repoDir, ".git", branchRef)
-	hash, err := readDigest(branchRefFile)
+	head, err := os.ReadFile(filepath.Join(dirs.gitDir, "HEAD"))
 	if err != nil {
 		return info, err
 	}
-	info.hash = hash
+	head = trimLineEnd(head)
 
-	return info, nil
+	ref, ok := bytes.CutPrefix(head, []byte("ref: "))
+	if !ok {
+		// A detached HEAD contains the digest itself.
+		info.hash, err = checkDigest(head)
+
+		return info, err
+	}
+
+	info.branch = strings.TrimPrefix(string(ref), "refs/heads/")
+	info.hash, err = resolveRef(dirs.commonDir, string(ref))
+
+	return info, err
 }
 
 func getBranchInfoViaGit(ctx context.Context, repoDir string) (branchInfo, error) {
@@ -119,9 +409,9 @@ func getBranchInfoViaGit(ctx context.Context, repoDir string) (branchInfo, error
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	// Get both branch name and hash in one call.
-	cmd := exec.CommandContext(ctx, "git", "-C", repoDir, "rev-parse", "--abbrev-ref", "HEAD", "HEAD")
-	output, err := cmd.Output()
+	// Get both hash and branch name in one call. (--abbrev-ref applies only
+	// to the revisions that follow it.)
+	output, err := gitOutput(ctx, "git rev-parse", "-C", repoDir, "rev-parse", "HEAD", "--abbrev-ref", "HEAD")
 	if err != nil {
 		return info, fmt.Errorf("failed to get branch info: %w", err)
 	}
@@ -131,46 +421,229 @@ func getBranchInfoViaGit(ctx context.Context, repoDir string) (branchInfo, error
 		return info, errors.New("unexpected git output format")
 	}
 
-	branch := string(lines[0])
-	if branch == "HEAD" {
-		return info, errDetachedHead
+	info.hash = digest(lines[0])
+	// Git reports a detached HEAD as the branch "HEAD".
+	if branch := string(lines[1]); branch != "HEAD" {
+		info.branch = branch
 	}
-	info.branch = branch
-	info.hash = digest(lines[1])
 
 	return info, nil
 }
 
-// getBranchRef reads the branch reference from .git/HEAD.
-func getBranchRef(repoDir string) (string, error) {
-	headFile := filepath.Join(repoDir, ".git", "HEAD")
-	data, err := os.ReadFile(headFile)
+// atTrackingTip reports whether HEAD is on a branch and at the commit where
+// origin's copy of that branch was last fetched. It runs no git commands.
+func atTrackingTip(repoDir string) bool {
+	info, err := getBranchInfoViaFilesystem(repoDir)
+	if err != nil || info.branch == "" {
+		return false
+	}
+
+	dirs, err := findGitDirs(repoDir)
 	if err != nil {
-		return "", err
+		return false
+	}
+
+	tip, err := resolveRef(dirs.commonDir, "refs/remotes/origin/"+info.branch)
+
+	return err == nil && tip.equals(info.hash)
+}
+
+func trimLineEnd(data []byte) []byte {
+	data = bytes.TrimSuffix(data, []byte("\r\n"))
+	data = bytes.TrimSuffix(data, []byte("\n"))
+
+	return data
+}
+
+// gitDirs holds the directories where a repository keeps its metadata.
+type gitDirs struct {
+	gitDir    string // HEAD
+	commonDir string // refs, packed-refs, and config
+}
+
+// findGitDirs locates a repository's metadata. Submodules and worktrees have a
+// .git file that points to the real git directory, and worktrees share refs
+// and config with the main repository through a commondir file. Otherwise,
+// both directories are simply .git.
+func findGitDirs(repoDir string) (gitDirs, error) {
+	var dirs gitDirs
+
+	dotGit := filepath.Join(repoDir, ".git")
+	info, err := os.Stat(dotGit)
+	if err != nil {
+		return dirs, err
+	}
+
+	dirs.gitDir = dotGit
+	if !info.IsDir() {
+		data, err := os.ReadFile(dotGit)
+		if err != nil {
+			return dirs, err
+		}
+
+		target, ok := bytes.CutPrefix(trimLineEnd(data), []byte("gitdir: "))
+		if !ok {
+			return dirs, fmt.Errorf("invalid .git file %q", dotGit)
+		}
+		dirs.gitDir = relativeTo(repoDir, string(target))
 	}
 
-	if !bytes.HasPrefix(data, []byte("ref: ")) {
-		return "", errDetachedHead
+	dirs.commonDir = dirs.gitDir
+	if data, err := os.ReadFile(filepath.Join(dirs.gitDir, "commondir")); err == nil {
+		dirs.commonDir = relativeTo(dirs.gitDir, string(trimLineEnd(data)))
 	}
 
-	data = bytes.TrimPrefix(data, []byte("ref: "))
-	data = trimLineEnd(data)
+	return dirs, nil
+}
+
+// relativeTo resolves a path that git may store relative to another directory.
+func relativeTo(baseDir, path string) string {
+	path = filepath.FromSlash(path)
+	if filepath.IsAbs(path) {
+		return path
+	}
 
-	return string(data), nil
+	return filepath.Join(baseDir, path)
 }
 
-func readDigest(filename string) (digest, error) {
-	data, err := os.ReadFile(filename)
+// resolveRef returns the digest that a ref such as refs/heads/main points to.
+// Git stores a ref either in its own file or, after git gc, in packed-refs.
+func resolveRef(commonDir, ref string) (digest, error) {
+	data, err := os.ReadFile(filepath.Join(commonDir, filepath.FromSlash(ref)))
+	if err == nil {
+		return checkDigest(trimLineEnd(data))
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	data, err = os.ReadFile(filepath.Join(commonDir, "packed-refs"))
 	if err != nil {
 		return nil, err
 	}
 
-	return digest(trimLineEnd(data)), nil
+	// Each line is "<digest> <ref>", except for comments and the "^<digest>"
+	// lines that follow annotated tags.
+	for line := range bytes.Lines(data) {
+		hash, name, ok := bytes.Cut(trimLineEnd(line), []byte(" "))
+		if ok && string(name) == ref {
+			return checkDigest(hash)
+		}
+	}
+
+	return nil, fmt.Errorf("cannot find ref %q: %w", ref, fs.ErrNotExist)
 }
 
-func trimLineEnd(data []byte) []byte {
-	data = bytes.TrimSuffix(data, []byte("\r\n"))
-	data = bytes.TrimSuffix(data, []byte("\n"))
+// checkDigest verifies that data is a full SHA-1 or SHA-256 digest.
+func checkDigest(data []byte) (digest, error) {
+	if len(data) != 40 && len(data) != 64 {
+		return nil, fmt.Errorf("invalid digest %q", data)
+	}
 
-	return data
+	for _, b := range data {
+		if !('0' <= b && b <= '9') && !('a' <= b && b <= 'f') {
+			return nil, fmt.Errorf("invalid digest %q", data)
+		}
+	}
+
+	return digest(data), nil
+}
+
+// repoURLViaFilesystem reads the origin remote's URL from a repository's
+// config file.
+func repoURLViaFilesystem(repoDir string) (string, error) {
+	dirs, err := findGitDirs(repoDir)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dirs.commonDir, "config"))
+	if err != nil {
+		return "", err
+	}
+
+	url, ok := configValue(data, "remote", "origin", "url")
+	if !ok || url == "" {
+		return "", errors.New("no URL for remote origin")
+	}
+
+	return url, nil
+}
+
+// configValue returns the value of a key in a git config file. If the key is
+// set more than once, the last value wins, as in git. Section and key names are
+// case-insensitive, but subsection names are not.
+func configValue(data []byte, section, subsection, key string) (string, bool) {
+	var value string
+	found := false
+	inSection := false
+
+	for line := range bytes.Lines(data) {
+		line = bytes.TrimSpace(line)
+
+		switch {
+		case len(line) == 0 || line[0] == '#' || line[0] == ';':
+			continue
+		case line[0] == '[':
+			inSection = isConfigSection(string(line), section, subsection)
+		case inSection:
+			name, rawValue, _ := strings.Cut(string(line), "=")
+			if strings.EqualFold(strings.TrimSpace(name), key) {
+				value = parseConfigValue(strings.TrimSpace(rawValue))
+				found = true
+			}
+		}
+	}
+
+	return value, found
+}
+
+// isConfigSection reports whether a header such as [remote "origin"] names
+// the given section and subsection. It also accepts the deprecated form
+// [remote.origin].
+func isConfigSection(header, section, subsection string) bool {
+	header, _, ok := strings.Cut(strings.TrimPrefix(header, "["), "]")
+	if !ok {
+		return false
+	}
+
+	name, sub, ok := strings.Cut(header, " ")
+	if ok {
+		sub = strings.TrimSpace(sub)
+		if len(sub) < 2 || sub[0] != '"' || sub[len(sub)-1] != '"' {
+			return false
+		}
+		sub = configEscapes.Replace(sub[1 : len(sub)-1])
+
+		return strings.EqualFold(name, section) && sub == subsection
+	}
+
+	name, sub, _ = strings.Cut(header, ".")
+
+	return strings.EqualFold(name, section) && strings.EqualFold(sub, subsection)
+}
+
+var configEscapes = strings.NewReplacer(`\\`, `\`, `\"`, `"`)
+
+// parseConfigValue removes quotes, backslash escapes, and trailing comments
+// from a raw config value.
+func parseConfigValue(raw string) string {
+	var value strings.Builder
+	inQuote := false
+
+	for i := 0; i < len(raw); i++ {
+		switch c := raw[i]; {
+		case c == '"':
+			inQuote = !inQuote
+		case c == '\\' && i+1 < len(raw):
+			i++
+			value.WriteByte(raw[i])
+		case (c == '#' || c == ';') && !inQuote:
+			return strings.TrimSpace(value.String())
+		default:
+			value.WriteByte(c)
+		}
+	}
+
+	return strings.TrimSpace(value.String())
 }
@@ -0,0 +1,261 @@
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const (
+	fakeHash    = "130e0427badfab6b587567d6bad3c06d44a373a5"
+	fakeOldHash = "2e32312b5b0fb7a9a7a4b0d8e2ef3f4e6a1c9d07"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetBranchInfoViaFilesystem(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		files    map[string]string
+		expected branchInfo
+	}{
+		"loose ref": {
+			files: map[string]string{
+				"plugin/.git/HEAD":            "ref: refs/heads/main\n",
+				"plugin/.git/refs/heads/main": fakeHash + "\n",
+			},
+			expected: branchInfo{branch: "main", hash: digest(fakeHash)},
+		},
+		"packed ref": {
+			files: map[string]string{
+				"plugin/.git/HEAD": "ref: refs/heads/main\n",
+				"plugin/.git/packed-refs": "# pack-refs with: peeled fully-peeled sorted\n" +
+					fakeOldHash + " refs/heads/dev\n" +
+					fakeHash + " refs/heads/main\n" +
+					fakeOldHash + " refs/tags/v1.0.0\n" +
+					"^" + fakeHash + "\n",
+			},
+			expected: branchInfo{branch: "main", hash: digest(fakeHash)},
+		},
+		"loose ref wins over packed ref": {
+			files: map[string]string{
+				"plugin/.git/HEAD":            "ref: refs/heads/main\n",
+				"plugin/.git/refs/heads/main": fakeHash + "\n",
+				"plugin/.git/packed-refs":     fakeOldHash + " refs/heads/main\n",
+			},
+			expected: branchInfo{branch: "main", hash: digest(fakeHash)},
+		},
+		"detached HEAD": {
+			files: map[string]string{
+				"plugin/.git/HEAD": fakeHash + "\n",
+			},
+			expected: branchInfo{hash: digest(fakeHash)},
+		},
+		"gitdir file": {
+			files: map[string]string{
+				"plugin/.git":                    "gitdir: ../modules/plugin\n",
+				"modules/plugin/HEAD":            "ref: refs/heads/main\n",
+				"modules/plugin/refs/heads/main": fakeHash + "\n",
+			},
+			expected: branchInfo{branch: "main", hash: digest(fakeHash)},
+		},
+		"worktree": {
+			files: map[string]string{
+				"plugin/.git":                          "gitdir: ../main/.git/worktrees/plugin\n",
+				"main/.git/worktrees/plugin/HEAD":      "ref: refs/heads/dev\n",
+				"main/.git/worktrees/plugin/commondir": "../..\n",
+				"main/.git/HEAD":                       "ref: refs/heads/main\n",
+				"main/.git/packed-refs":                fakeOldHash + " refs/heads/dev\n",
+			},
+			expected: branchInfo{branch: "dev", hash: digest(fakeOldHash)},
+		},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			writeFiles(t, root, tc.files)
+
+			actual, err := getBranchInfoViaFilesystem(filepath.Join(root, "plugin"))
+			if err != nil {
+				t.Fatalf("getBranchInfoViaFilesystem() error: %s", err)
+			}
+
+			if diff := cmp.Diff(tc.expected, actual, cmp.AllowUnexported(branchInfo{})); diff != "" {
+				t.Errorf("getBranchInfoViaFilesystem() failure (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetBranchInfoViaFilesystemErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]map[string]string{
+		"missing ref": {
+			"plugin/.git/HEAD": "ref: refs/heads/main\n",
+		},
+		"ref not in packed-refs": {
+			"plugin/.git/HEAD":        "ref: refs/heads/main\n",
+			"plugin/.git/packed-refs": fakeHash + " refs/heads/dev\n",
+		},
+		"invalid digest": {
+			"plugin/.git/HEAD": "not a digest\n",
+		},
+		"invalid .git file": {
+			"plugin/.git": "this is not a gitdir line\n",
+		},
+	}
+
+	for msg, files := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			writeFiles(t, root, files)
+
+			if _, err := getBranchInfoViaFilesystem(filepath.Join(root, "plugin")); err == nil {
+				t.Error("getBranchInfoViaFilesystem() returned no error")
+			}
+		})
+	}
+}
+
+func TestConfigValue(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		config   string
+		remote   string // "origin" if empty
+		expected string
+		found    bool
+	}{
+		"typical": {
+			config: "[core]\n\tbare = false\n" +
+				"[remote \"origin\"]\n\turl = https://github.com/foo/foo.git\n" +
+				"\tfetch = +refs/heads/*:refs/remotes/origin/*\n",
+			expected: "https://github.com/foo/foo.git",
+			found:    true,
+		},
+		"other remote": {
+			config: "[remote \"upstream\"]\n\turl = https://github.com/bar/bar.git\n",
+		},
+		"case-insensitive names": {
+			config:   "[Remote \"origin\"]\n\tURL = https://github.com/foo/foo.git\n",
+			expected: "https://github.com/foo/foo.git",
+			found:    true,
+		},
+		"case-sensitive subsection": {
+			config: "[remote \"Origin\"]\n\turl = https://github.com/foo/foo.git\n",
+		},
+		"deprecated header": {
+			config:   "[remote.origin]\n\turl = https://github.com/foo/foo.git\n",
+			expected: "https://github.com/foo/foo.git",
+			found:    true,
+		},
+		"quotes and comments": {
+			config:   "# comment\n[remote \"origin\"]\n\t; comment\n\turl = \"/tmp/my plugins/foo\" # comment\n",
+			expected: "/tmp/my plugins/foo",
+			found:    true,
+		},
+		"escaped subsection": {
+			config:   "[remote \"my \\\"fork\\\" \\\\ mirror\"]\n\turl = https://github.com/foo/foo.git\n",
+			remote:   `my "fork" \ mirror`,
+			expected: "https://github.com/foo/foo.git",
+			found:    true,
+		},
+		"last value wins": {
+			config: "[remote \"origin\"]\n\turl = https://github.com/old/foo.git\n" +
+				"[remote \"origin\"]\n\turl = https://github.com/new/foo.git\n",
+			expected: "https://github.com/new/foo.git",
+			found:    true,
+		},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			remote := tc.remote
+			if remote == "" {
+				remote = "origin"
+			}
+
+			actual, found := configValue([]byte(tc.config), "remote", remote, "url")
+			if actual != tc.expected || found != tc.found {
+				t.Errorf("configValue(%q) = %q, %t; want %q, %t", remote, actual, found, tc.expected, tc.found)
+			}
+		})
+	}
+}
+
+func TestTagCommitViaFilesystem(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := t.TempDir()
+	mustGit(t, repo, "init", "--quiet")
+	mustGit(t, repo, "commit", "--quiet", "--allow-empty", "-m", "first")
+	mustGit(t, repo, "tag", "light")
+	mustGit(t, repo, "tag", "-a", "-m", "annotated", "annotated")
+	mustGit(t, repo, "tag", "-a", "-m", "nested", "nested", "annotated")
+	mustGit(t, repo, "commit", "--quiet", "--allow-empty", "-m", "second")
+	mustGit(t, repo, "tag", "-a", "-m", "later", "later")
+
+	info, err := getBranchInfoViaFilesystem(repo)
+	if err != nil {
+		t.Fatalf("test cannot finish since getBranchInfoViaFilesystem() failed: %v", err)
+	}
+	first, err := tagCommitViaGit(t.Context(), repo, "light")
+	if err != nil {
+		t.Fatalf("test cannot finish since tagCommitViaGit() failed: %v", err)
+	}
+
+	expected := map[string]digest{
+		"light":     first,
+		"annotated": first,
+		"nested":    first,
+		"later":     info.hash,
+		"missing":   nil,
+	}
+
+	// The tags and objects start out loose, and gc packs them.
+	for _, stage := range []string{"loose", "packed"} {
+		if stage == "packed" {
+			mustGit(t, repo, "gc", "--quiet")
+		}
+
+		for tag, commit := range expected {
+			actual, err := tagCommitViaFilesystem(repo, tag)
+			if err != nil {
+				t.Errorf("tagCommitViaFilesystem(%q) when %s failed: %v", tag, stage, err)
+				continue
+			}
+
+			if !actual.equals(commit) {
+				t.Errorf("tagCommitViaFilesystem(%q) when %s = %s; want %s", tag, stage, actual, commit)
+			}
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// gitError reports a failed git command along with what git printed to
+// stderr, which tells one kind of failure apart from another.
+type gitError struct {
+	err      error
+	op       string // E.g., "git clone"
+	stderr   string
+	timedOut bool
+}
+
+func (e *gitError) Error() string {
+	if e.timedOut {
+		return e.op + " timed out"
+	}
+
+	if line := lastLine(e.stderr); line != "" {
+		return e.op + " failed: " + line
+	}
+
+	return e.op + " failed: " + e.err.Error()
+}
+
+// Unwrap returns the underlying error and, if git's stderr shows what went
+// wrong, the failure's class. This lets callers use errors.Is and errors.As
+// with the classes below.
+func (e *gitError) Unwrap() []error {
+	var errs []error
+	if e.err != nil {
+		errs = append(errs, e.err)
+	}
+	if class := e.class(); class != nil {
+		errs = append(errs, class)
+	}
+
+	return errs
+}
+
+func (e *gitError) class() *failureClass {
+	if e.timedOut {
+		return errTimeout
+	}
+
+	msg := strings.ToLower(e.stderr)
+	for _, class := range failureClasses {
+		if class.matches(msg) {
+			return class
+		}
+	}
+
+	return nil
+}
+
+// failureClass is a common kind of git failure and what to do about it.
+type failureClass struct {
+	pattern  *regexp.Regexp
+	name     string // For JSON output
+	desc     string // For text output
+	hint     string
+	patterns []string
+}
+
+func (c *failureClass) Error() string {
+	return c.desc
+}
+
+func (c *failureClass) matches(msg string) bool {
+	for _, p := range c.patterns {
+		if strings.Contains(msg, p) {
+			return true
+		}
+	}
+
+	return c.pattern != nil && c.pattern.MatchString(msg)
+}
+
+var (
+	errAuth = &failureClass{
+		name: "auth",
+		desc: "authentication failed",
+		hint: "check your credentials or SSH key and that you can access the repository",
+		patterns: []string{
+			"authentication failed",
+			"could not read username",
+			"could not read password",
+			"invalid username or password",
+			"host key verification failed",
+		},
+		// SSH lists the methods that it tried, which tells its "Permission
+		// denied" apart from a local file that cannot be written.
+		pattern: regexp.MustCompile(`returned error: 40[13]|permission denied \([\w,-]+\)`),
+	}
+	errRepoNotFound = &failureClass{
+		name: "repo-not-found",
+		desc: "repository not found",
+		hint: "check the plugin's url",
+		patterns: []string{
+			"repository not found",
+			"does not appear to be a git repository",
+		},
+		pattern: regexp.MustCompile(`repository '.*' (not found|does not exist)|returned error: 404`),
+	}
+	errRefNotFound = &failureClass{
+		name: "ref-not-found",
+		desc: "branch or ref not found",
+		hint: "check the plugin's branch, tag, or commit",
+		patterns: []string{
+			"not found in upstream",
+			"couldn't find remote ref",
+			"unknown revision",
+			"invalid reference",
+			"no such ref was fetched",
+		},
+	}
+	errNonFastForward = &failureClass{
+		name: "non-fast-forward",
+		desc: "history diverged",
+		hint: "the plugin has local changes; use --force to discard them",
+		patterns: []string{
+			"not possible to fast-forward",
+			"diverging branches",
+			"divergent branches",
+			"non-fast-forward",
+		},
+	}
+	// errNetwork covers failures that may not happen again, so it is the only
+	// class that pluggo retries.
+	errNetwork = &failureClass{
+		name: "network",
+		desc: "network error",
+		hint: "check your network connection and try again",
+		patterns: []string{
+			"could not resolve host",
+			"temporary failure in name resolution",
+			"connection reset",
+			"connection refused",
+			"connection timed out",
+			"operation timed out",
+			"network is unreachable",
+			"early eof",
+			"the remote end hung up unexpectedly",
+			"unexpected disconnect",
+			"rpc failed",
+			"gnutls_handshake() failed",
+			"tls connection was non-properly terminated",
+		},
+		pattern: regexp.MustCompile(`returned error: 5\d\d`),
+	}
+	errTimeout = &failureClass{
+		name: "timeout",
+		desc: "timed out",
+		hint: `raise the "timeout" for the plugin in the configuration file`,
+	}
+)
+
+// failureClasses are checked in order. The classes that no retry will fix
+// come before errNetwork since git often follows a specific message with a
+// generic one, such as "the remote end hung up unexpectedly", that may also
+// mean a network failure.
+var failureClasses = []*failureClass{
+	errAuth,
+	errRepoNotFound,
+	errRefNotFound,
+	errNonFastForward,
+	errNetwork,
+}
+
+// classOf returns the class of a failure or nil if the class is unknown.
+func classOf(err error) *failureClass {
+	var class *failureClass
+	if errors.As(err, &class) {
+		return class
+	}
+
+	return nil
+}
+
+// runGit runs a git command that needs no output.
+func runGit(ctx context.Context, op string, args ...string) error {
+	_, err := gitOutput(ctx, op, args...)
+
+	return err
+}
+
+// gitOutput runs a git command and returns what it prints to stdout. If the
+// command fails, the error keeps what it printed to stderr.
+func gitOutput(ctx context.Context, op string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := newCommand(ctx, "git", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, &gitError{
+			err:      err,
+			op:       op,
+			stderr:   strings.TrimSpace(stderr.String()),
+			timedOut: errors.Is(ctx.Err(), context.DeadlineExceeded),
+		}
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return strings.TrimSpace(s[i+1:])
+	}
+
+	return s
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestGitErrorClass(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		err      *gitError
+		expected *failureClass
+	}{
+		"https auth": {
+			err:      &gitError{stderr: "remote: Invalid username or password.\nfatal: Authentication failed for 'https://example.com/foo/'"},
+			expected: errAuth,
+		},
+		"ssh auth": {
+			err:      &gitError{stderr: "git@example.com: Permission denied (publickey).\nfatal: Could not read from remote repository."},
+			expected: errAuth,
+		},
+		"ssh auth with several methods": {
+			err:      &gitError{stderr: "git@example.com: Permission denied (publickey,keyboard-interactive)."},
+			expected: errAuth,
+		},
+		"local permission denied": {
+			err: &gitError{stderr: "fatal: could not create work tree dir '/srv/pack/start/foo': Permission denied"},
+		},
+		"no terminal for credentials": {
+			err:      &gitError{stderr: "fatal: could not read Username for 'https://example.com': terminal prompts disabled"},
+			expected: errAuth,
+		},
+		"forbidden": {
+			err:      &gitError{stderr: "fatal: unable to access 'https://example.com/foo/': The requested URL returned error: 403"},
+			expected: errAuth,
+		},
+		"github missing repo": {
+			err:      &gitError{stderr: "remote: Repository not found.\nfatal: repository 'https://github.com/foo/bar/' not found"},
+			expected: errRepoNotFound,
+		},
+		"local missing repo": {
+			err:      &gitError{stderr: "fatal: repository '/tmp/missing' does not exist"},
+			expected: errRepoNotFound,
+		},
+		"not a repo": {
+			err:      &gitError{stderr: "fatal: '/tmp/foo' does not appear to be a git repository\nfatal: Could not read from remote repository."},
+			expected: errRepoNotFound,
+		},
+		"missing branch": {
+			err:      &gitError{stderr: "warning: Could not find remote branch nope to clone.\nfatal: Remote branch nope not found in upstream origin"},
+			expected: errRefNotFound,
+		},
+		"missing commit": {
+			err:      &gitError{stderr: "fatal: couldn't find remote ref deadbeef"},
+			expected: errRefNotFound,
+		},
+		"diverged": {
+			err:      &gitError{stderr: "hint: Diverging branches can't be fast-forwarded.\nfatal: Not possible to fast-forward, aborting."},
+			expected: errNonFastForward,
+		},
+		"dns": {
+			err:      &gitError{stderr: "fatal: unable to access 'https://example.com/foo/': Could not resolve host: example.com"},
+			expected: errNetwork,
+		},
+		"server error": {
+			err:      &gitError{stderr: "fatal: unable to access 'https://example.com/foo/': The requested URL returned error: 502"},
+			expected: errNetwork,
+		},
+		"timeout": {
+			err:      &gitError{stderr: "remote: Enumerating objects: 5", timedOut: true},
+			expected: errTimeout,
+		},
+		"unknown": {
+			err: &gitError{stderr: "fatal: something odd happened"},
+		},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			// Wrap the error as callers do to check that the class survives.
+			err := fmt.Errorf("clone failed: %w", tc.err)
+			if actual := classOf(err); actual != tc.expected {
+				t.Errorf("classOf(%q) = %v; want %v", tc.err.stderr, actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestGitErrorMessage(t *testing.T) {
+	t.Parallel()
+
+	exitErr := errors.New("exit status 128")
+	tests := map[string]struct {
+		err      *gitError
+		expected string
+	}{
+		"last stderr line": {
+			err:      &gitError{err: exitErr, op: "git clone", stderr: "remote: Repository not found.\nfatal: repository 'x' not found"},
+			expected: "git clone failed: fatal: repository 'x' not found",
+		},
+		"no stderr": {
+			err:      &gitError{err: exitErr, op: "git pull"},
+			expected: "git pull failed: exit status 128",
+		},
+		"timed out": {
+			err:      &gitError{err: errors.New("signal: killed"), op: "git clone", timedOut: true},
+			expected: "git clone timed out",
+		},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := tc.err.Error(); actual != tc.expected {
+				t.Errorf("gitError.Error() = %q; want %q", actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestGitOutputTimeout(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 0)
+	defer cancel()
+
+	_, err := gitOutput(ctx, "git version", "version")
+	if !errors.Is(err, errTimeout) {
+		t.Errorf("gitOutput() with expired context = %v; want %v", err, errTimeout)
+	}
+}
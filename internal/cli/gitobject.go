@@ -0,0 +1,425 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// maxTagDepth limits how many tags peelToCommit follows, since a tag may
+// point to another tag.
+const maxTagDepth = 10
+
+// errUnsupportedObject reports an object that readObject cannot find, such as
+// one in an alternate object store. Callers fall back to git.
+var errUnsupportedObject = errors.New("unsupported object storage")
+
+// peelToCommit follows annotated tags from an object until it reaches a
+// commit and returns the commit.
+func peelToCommit(commonDir string, hash digest) (digest, error) {
+	for range maxTagDepth {
+		kind, content, err := readObject(commonDir, hash)
+		if err != nil {
+			return nil, err
+		}
+
+		switch kind {
+		case "commit":
+			return hash, nil
+		case "tag":
+			// A tag's content starts with "object <digest>".
+			line, _, _ := bytes.Cut(content, []byte("\n"))
+			target, ok := bytes.CutPrefix(line, []byte("object "))
+			if !ok {
+				return nil, fmt.Errorf("invalid tag object %s", hash)
+			}
+			if hash, err = checkDigest(target); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%s is a %s, not a commit", hash, kind)
+		}
+	}
+
+	return nil, fmt.Errorf("tags nested more than %d deep at %s", maxTagDepth, hash)
+}
+
+// readObject returns the type and content of an object from the repository's
+// loose objects or pack files.
+func readObject(commonDir string, hash digest) (string, []byte, error) {
+	return readObjectAt(commonDir, hash, 0)
+}
+
+// readObjectAt reads an object as readObject does. The depth counts the
+// deltas already applied to reach it.
+func readObjectAt(commonDir string, hash digest, depth int) (string, []byte, error) {
+	objectsDir := filepath.Join(commonDir, "objects")
+
+	hexHash := hash.String()
+	data, err := os.ReadFile(filepath.Join(objectsDir, hexHash[:2], hexHash[2:]))
+	if err == nil {
+		return readLooseObject(data)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", nil, err
+	}
+
+	idxFiles, err := filepath.Glob(filepath.Join(objectsDir, "pack", "*.idx"))
+	if err != nil {
+		return "", nil, err
+	}
+
+	rawHash, err := hex.DecodeString(hexHash)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, idxFile := range idxFiles {
+		offset, found, err := findInPackIndex(idxFile, rawHash)
+		if err != nil {
+			return "", nil, err
+		}
+		if found {
+			packFile := idxFile[:len(idxFile)-len(".idx")] + ".pack"
+
+			return readPackedObject(commonDir, packFile, offset, len(rawHash), depth)
+		}
+	}
+
+	// The object may be in an alternate object store, for example.
+	return "", nil, fmt.Errorf("cannot find object %s: %w", hash, errUnsupportedObject)
+}
+
+// readLooseObject reads a compressed object of the form
+// "<type> <size>\x00<content>".
+func readLooseObject(data []byte) (string, []byte, error) {
+	data, err := inflate(bytes.NewReader(data))
+	if err != nil {
+		return "", nil, err
+	}
+
+	header, content, ok := bytes.Cut(data, []byte{0})
+	if !ok {
+		return "", nil, errors.New("invalid loose object")
+	}
+	kind, _, _ := bytes.Cut(header, []byte(" "))
+
+	return string(kind), content, nil
+}
+
+// inflate reads zlib-compressed data.
+func inflate(r io.Reader) ([]byte, error) {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := zr.Close(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// packIndexMagic starts a version 2 pack index.
+var packIndexMagic = []byte{0xff, 't', 'O', 'c', 0, 0, 0, 2}
+
+// findInPackIndex looks up an object in a version 2 pack index and returns
+// where the object starts in the pack file.
+func findInPackIndex(idxFile string, rawHash []byte) (int64, bool, error) {
+	data, err := os.ReadFile(idxFile)
+	if err != nil {
+		return 0, false, err
+	}
+
+	const fanoutSize = 256 * 4
+	hashSize := len(rawHash)
+	if len(data) < len(packIndexMagic)+fanoutSize || !bytes.Equal(data[:len(packIndexMagic)], packIndexMagic) {
+		return 0, false, fmt.Errorf("pack index %q: %w", idxFile, errUnsupportedObject)
+	}
+
+	// The fanout table counts the objects whose first byte is at most each
+	// value, so objects that start with rawHash[0] are in [lo, hi).
+	fanout := data[len(packIndexMagic):]
+	count := int(binary.BigEndian.Uint32(fanout[255*4:]))
+	hi := int(binary.BigEndian.Uint32(fanout[int(rawHash[0])*4:]))
+	lo := 0
+	if rawHash[0] > 0 {
+		lo = int(binary.BigEndian.Uint32(fanout[int(rawHash[0]-1)*4:]))
+	}
+
+	// The hashes are followed by a CRC and a 4-byte offset for each object
+	// and then by any 8-byte offsets.
+	hashes := data[len(packIndexMagic)+fanoutSize:]
+	if hi > count || lo > hi || len(hashes) < count*(hashSize+8) {
+		return 0, false, fmt.Errorf("pack index %q is truncated", idxFile)
+	}
+	offsets := hashes[count*(hashSize+4):]
+	largeOffsets := offsets[count*4:]
+
+	i := lo + sort.Search(hi-lo, func(j int) bool {
+		return bytes.Compare(hashes[(lo+j)*hashSize:(lo+j+1)*hashSize], rawHash) >= 0
+	})
+	if i >= hi || !bytes.Equal(hashes[i*hashSize:(i+1)*hashSize], rawHash) {
+		return 0, false, nil
+	}
+
+	offset := binary.BigEndian.Uint32(offsets[i*4:])
+	if offset&0x80000000 == 0 {
+		return int64(offset), true, nil
+	}
+
+	// Offsets past 2 GiB live in a table of 8-byte offsets.
+	j := int(offset &^ 0x80000000)
+	if len(largeOffsets) < (j+1)*8 {
+		return 0, false, fmt.Errorf("pack index %q is truncated", idxFile)
+	}
+
+	large := binary.BigEndian.Uint64(largeOffsets[j*8:])
+	if large > math.MaxInt64 {
+		return 0, false, fmt.Errorf("pack index %q has an invalid offset", idxFile)
+	}
+
+	return int64(large), true, nil
+}
+
+// Object types in pack files
+const (
+	packCommit   = 1
+	packTree     = 2
+	packBlob     = 3
+	packTag      = 4
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+// maxDeltaDepth limits how many deltas readPackedObject applies to build one
+// object. Git itself never writes longer chains.
+const maxDeltaDepth = 4095
+
+// packReader reads objects from a pack file.
+type packReader struct {
+	f         *os.File
+	commonDir string
+	hashSize  int
+}
+
+// readPackedObject reads the object at an offset in a pack file.
+func readPackedObject(commonDir, packFile string, offset int64, hashSize, depth int) (string, []byte, error) {
+	f, err := os.Open(packFile)
+	if err != nil {
+		return "", nil, err
+	}
+
+	p := packReader{f: f, commonDir: commonDir, hashSize: hashSize}
+	kind, content, err := p.read(offset, depth)
+	if closeErr := f.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("pack %q: %w", packFile, err)
+	}
+
+	return kind, content, nil
+}
+
+// read reads the entry at an offset and applies it to its base if it is a
+// delta. The depth counts the deltas already applied.
+func (p packReader) read(offset int64, depth int) (string, []byte, error) {
+	if depth > maxDeltaDepth {
+		return "", nil, fmt.Errorf("deltas nested more than %d deep", maxDeltaDepth)
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(p.f, offset, math.MaxInt64-offset))
+	kind, err := readPackHeader(r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var baseKind string
+	var base []byte
+	switch kind {
+	case packCommit, packTree, packBlob, packTag:
+		content, err := inflate(r)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return packTypeName(kind), content, nil
+	case packOfsDelta:
+		// The base comes earlier in the same pack.
+		rel, err := readDeltaOffset(r)
+		if err != nil {
+			return "", nil, err
+		}
+		if rel <= 0 || rel > offset {
+			return "", nil, fmt.Errorf("invalid delta offset at %d", offset)
+		}
+		baseKind, base, err = p.read(offset-rel, depth+1)
+		if err != nil {
+			return "", nil, err
+		}
+	case packRefDelta:
+		// The base is named by its hash.
+		rawHash := make([]byte, p.hashSize)
+		if _, err := io.ReadFull(r, rawHash); err != nil {
+			return "", nil, err
+		}
+		baseKind, base, err = readObjectAt(p.commonDir, digest(hex.EncodeToString(rawHash)), depth+1)
+		if err != nil {
+			return "", nil, err
+		}
+	default:
+		return "", nil, fmt.Errorf("invalid object type %d at %d", kind, offset)
+	}
+
+	delta, err := inflate(r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	content, err := applyDelta(base, delta)
+	if err != nil {
+		return "", nil, fmt.Errorf("delta at %d: %w", offset, err)
+	}
+
+	return baseKind, content, nil
+}
+
+// readPackHeader reads the header of a pack entry and returns the entry's
+// type. The header packs the type into bits 4-6 of its first byte, followed
+// by the size in a variable-length encoding that sets the top bit of every
+// byte but the last.
+func readPackHeader(r *bufio.Reader) (byte, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	kind := (b >> 4) & 0x7
+
+	for b&0x80 != 0 {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+
+	return kind, nil
+}
+
+// readDeltaOffset reads how far back in the pack an offset delta's base
+// starts. Unlike the sizes in headers, the offset puts its most significant
+// bits first and adds one for each byte after the first.
+func readDeltaOffset(r *bufio.Reader) (int64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	rel := int64(b & 0x7f)
+
+	for b&0x80 != 0 {
+		if rel >= math.MaxInt64>>7 {
+			return 0, errors.New("delta offset overflows")
+		}
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+		rel = (rel+1)<<7 | int64(b&0x7f)
+	}
+
+	return rel, nil
+}
+
+func packTypeName(kind byte) string {
+	switch kind {
+	case packCommit:
+		return "commit"
+	case packTree:
+		return "tree"
+	case packBlob:
+		return "blob"
+	default:
+		return "tag"
+	}
+}
+
+// errInvalidDelta reports a delta that does not fit its base.
+var errInvalidDelta = errors.New("invalid delta")
+
+// applyDelta builds an object from a base and a delta. A delta starts with the
+// sizes of the base and the result, followed by instructions that either copy
+// a range of the base or insert new data.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	baseSize, n := binary.Uvarint(delta)
+	if n <= 0 || baseSize != uint64(len(base)) {
+		return nil, errInvalidDelta
+	}
+	delta = delta[n:]
+
+	size, n := binary.Uvarint(delta)
+	if n <= 0 {
+		return nil, errInvalidDelta
+	}
+	delta = delta[n:]
+
+	out := make([]byte, 0, min(size, uint64(len(base)+len(delta))))
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+
+		switch {
+		case op&0x80 != 0:
+			// Bits 0-3 say which bytes of the offset follow, and bits 4-6
+			// say which bytes of the length follow.
+			var start, length uint64
+			for i := range 7 {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, errInvalidDelta
+				}
+				if i < 4 {
+					start |= uint64(delta[0]) << (8 * i)
+				} else {
+					length |= uint64(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if length == 0 {
+				length = 0x10000
+			}
+			if start+length > uint64(len(base)) {
+				return nil, errInvalidDelta
+			}
+			out = append(out, base[start:start+length]...)
+		case op != 0:
+			if int(op) > len(delta) {
+				return nil, errInvalidDelta
+			}
+			out = append(out, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, errInvalidDelta
+		}
+	}
+
+	if uint64(len(out)) != size {
+		return nil, errInvalidDelta
+	}
+
+	return out, nil
+}
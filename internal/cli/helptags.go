@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// helpTag is a single *tag* target found in a help file.
+type helpTag struct {
+	name string
+	file string
+}
+
+// helptags writes tags files for the help files in a plugin's doc/ directory,
+// as Vim's :helptags does. English help files (*.txt) produce doc/tags, and
+// localized help files (e.g., *.jax) produce doc/tags-ja and so on.
+func helptags(pluginDir string) error {
+	docDir := filepath.Join(pluginDir, "doc")
+
+	entries, err := os.ReadDir(docDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read %q: %w", docDir, err)
+	}
+
+	filesByLang := make(map[string][]string)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		if lang, ok := helpLang(entry.Name()); ok {
+			filesByLang[lang] = append(filesByLang[lang], entry.Name())
+		}
+	}
+
+	for lang, files := range filesByLang {
+		if err := writeHelpTags(docDir, lang, files); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// helpLang returns the language of a help file: "" for English *.txt files
+// and a two-letter code for localized files such as *.jax. The boolean is
+// false if the file is not a help file.
+func helpLang(filename string) (string, bool) {
+	if strings.HasSuffix(filename, ".txt") {
+		return "", true
+	}
+
+	n := len(filename)
+	if n <= 4 || filename[n-4] != '.' || filename[n-1] != 'x' {
+		return "", false
+	}
+
+	if !isASCIILetter(filename[n-3]) || !isASCIILetter(filename[n-2]) {
+		return "", false
+	}
+
+	return strings.ToLower(filename[n-3 : n-1]), true
+}
+
+func isASCIILetter(b byte) bool {
+	return ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+}
+
+// writeHelpTags collects the tags in one language's help files and writes
+// them, sorted, to the matching tags file.
+func writeHelpTags(docDir, lang string, files []string) error {
+	var tags []helpTag
+	hasUTF8 := false
+
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(docDir, file))
+		if err != nil {
+			return fmt.Errorf("cannot read help file %q: %w", file, err)
+		}
+
+		// Like Vim, detect UTF-8 by a non-ASCII character in the first line.
+		firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+		if !isASCII(firstLine) && utf8.Valid(firstLine) {
+			hasUTF8 = true
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+		for scanner.Scan() {
+			for _, name := range findHelpTags(scanner.Text()) {
+				tags = append(tags, helpTag{name: name, file: file})
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("cannot read help file %q: %w", file, err)
+		}
+	}
+
+	slices.SortFunc(tags, func(a, b helpTag) int {
+		return strings.Compare(a.name+"\t"+a.file, b.name+"\t"+b.file)
+	})
+
+	var buf bytes.Buffer
+	if hasUTF8 {
+		buf.WriteString("!_TAG_FILE_ENCODING\tutf-8\t//\n")
+	}
+	for _, tag := range tags {
+		buf.WriteString(formatHelpTag(tag))
+	}
+
+	tagsFile := "tags"
+	if lang != "" {
+		tagsFile += "-" + lang
+	}
+
+	return writeFileAtomic(filepath.Join(docDir, tagsFile), buf.Bytes())
+}
+
+// findHelpTags returns the *tag* targets in a line of a help file. As in Vim,
+// a tag must not contain a space, tab, or bar, it must start the line or
+// follow whitespace, and it must end the line or precede whitespace.
+func findHelpTags(line string) []string {
+	var tags []string
+
+	start := strings.IndexByte(line, '*')
+	for start >= 0 {
+		next := strings.IndexByte(line[start+1:], '*')
+		if next < 0 {
+			break
+		}
+		end := start + 1 + next
+
+		name := line[start+1 : end]
+		if name != "" &&
+			!strings.ContainsAny(name, " \t|") &&
+			(start == 0 || line[start-1] == ' ' || line[start-1] == '\t') &&
+			(end == len(line)-1 || strings.IndexByte(" \t\r\n", line[end+1]) >= 0) {
+			tags = append(tags, name)
+		}
+
+		start = end
+	}
+
+	return tags
+}
+
+// formatHelpTag returns a line of a tags file. The search pattern escapes
+// backslashes and slashes.
+func formatHelpTag(tag helpTag) string {
+	var pattern strings.Builder
+	for _, r := range tag.name {
+		if r == '\\' || r == '/' {
+			pattern.WriteByte('\\')
+		}
+		pattern.WriteRune(r)
+	}
+
+	return tag.name + "\t" + tag.file + "\t/*" + pattern.String() + "*\n"
+}
+
+func isASCII(data []byte) bool {
+	for _, b := range data {
+		if b >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
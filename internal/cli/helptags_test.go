@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFindHelpTags(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		line     string
+		expected []string
+	}{
+		"start of line":     {line: "*foo.txt*\tFor Vim", expected: []string{"foo.txt"}},
+		"several tags":      {line: "\t\t*foo* *foo-intro*", expected: []string{"foo", "foo-intro"}},
+		"inside a word":     {line: "x*inline* text", expected: nil},
+		"contains a space":  {line: "*not a tag*", expected: nil},
+		"contains a bar":    {line: "*a|b*", expected: nil},
+		"empty stars":       {line: "** * *ok*", expected: []string{"ok"}},
+		"carriage return":   {line: "*zzz*\r", expected: []string{"zzz"}},
+		"special character": {line: "*<Plug>(foo)* *'foo'*", expected: []string{"<Plug>(foo)", "'foo'"}},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			if diff := cmp.Diff(tc.expected, findHelpTags(tc.line)); diff != "" {
+				t.Errorf("findHelpTags(%q) failure (-want +got)\n%s", tc.line, diff)
+			}
+		})
+	}
+}
+
+func TestHelptags(t *testing.T) {
+	t.Parallel()
+
+	pluginDir := t.TempDir()
+	docDir := filepath.Join(pluginDir, "doc")
+	if err := os.Mkdir(docDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"foo.txt":   "*foo.txt*\tFor Vim\n\n*foo/bar* *foo*\n",
+		"foo.jax":   "*foo.txt*\n*foo-ja*\n",
+		"notes.md":  "*ignored*\n",
+		"other.abc": "*ignored*\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(docDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := helptags(pluginDir); err != nil {
+		t.Fatalf("helptags(%q) failed: %v", pluginDir, err)
+	}
+
+	expected := map[string]string{
+		"tags":    "foo\tfoo.txt\t/*foo*\nfoo.txt\tfoo.txt\t/*foo.txt*\nfoo/bar\tfoo.txt\t/*foo\\/bar*\n",
+		"tags-ja": "foo-ja\tfoo.jax\t/*foo-ja*\nfoo.txt\tfoo.jax\t/*foo.txt*\n",
+	}
+	for name, want := range expected {
+		got, err := os.ReadFile(filepath.Join(docDir, name))
+		if err != nil {
+			t.Fatalf("cannot read %s: %v", name, err)
+		}
+
+		if diff := cmp.Diff(want, string(got)); diff != "" {
+			t.Errorf("helptags(%q) %s failure (-want +got)\n%s", pluginDir, name, diff)
+		}
+	}
+}
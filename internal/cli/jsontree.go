@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+type jsonKind int
+
+const (
+	scalarKind jsonKind = iota
+	objectKind
+	arrayKind
+)
+
+// jsonValue is a parsed config value that remembers where it came from, so
+// that problems with it can be reported by line and column. Configs in every
+// format parse into jsonValues.
+type jsonValue struct {
+	fields []jsonField  // Only for objects, in order and with duplicates
+	items  []*jsonValue // Only for arrays
+	raw    []byte       // The value's JSON
+	offset int64        // Where the value starts
+	kind   jsonKind
+}
+
+type jsonField struct {
+	value  *jsonValue
+	key    string
+	offset int64 // Where the key starts
+}
+
+// field returns the value of an object's key or nil if the key is missing.
+// Like json.Unmarshal, field uses the last of any duplicate keys.
+func (v *jsonValue) field(key string) *jsonValue {
+	for i := len(v.fields) - 1; i >= 0; i-- {
+		if v.fields[i].key == key {
+			return v.fields[i].value
+		}
+	}
+
+	return nil
+}
+
+// fieldOffset returns where the first of keys that an object has starts or,
+// if it has none of them, where the object starts.
+func (v *jsonValue) fieldOffset(keys ...string) int64 {
+	for _, key := range keys {
+		for _, f := range v.fields {
+			if f.key == key {
+				return f.offset
+			}
+		}
+	}
+
+	return v.offset
+}
+
+// configSyntaxError reports a config that cannot be parsed and where the
+// problem is.
+type configSyntaxError struct {
+	msg    string
+	offset int64
+}
+
+func (e *configSyntaxError) Error() string {
+	return e.msg
+}
+
+// parseJSON parses a single JSON value.
+func parseJSON(data []byte) (*jsonValue, error) {
+	p := jsonParser{data: data, dec: json.NewDecoder(bytes.NewReader(data))}
+	p.dec.UseNumber()
+
+	v, err := p.value()
+	if err != nil {
+		return nil, p.syntaxError(err)
+	}
+
+	start := p.start()
+	if _, err := p.dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, &configSyntaxError{msg: "invalid JSON: unexpected data after the top-level value", offset: start}
+	}
+
+	return v, nil
+}
+
+type jsonParser struct {
+	dec  *json.Decoder
+	data []byte
+}
+
+// start returns where the next token starts. The decoder reports where the
+// last token ended, which may be followed by whitespace and a separator.
+func (p *jsonParser) start() int64 {
+	offset := p.dec.InputOffset()
+	for offset < int64(len(p.data)) && bytes.IndexByte([]byte(" \t\r\n,:"), p.data[offset]) >= 0 {
+		offset++
+	}
+
+	return offset
+}
+
+func (p *jsonParser) value() (*jsonValue, error) {
+	start := p.start()
+	tok, err := p.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &jsonValue{offset: start}
+	switch tok {
+	case json.Delim('{'):
+		v.kind = objectKind
+		for p.dec.More() {
+			keyStart := p.start()
+			keyTok, err := p.dec.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			fieldValue, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+
+			// The decoder only returns strings for keys.
+			key, _ := keyTok.(string)
+			v.fields = append(v.fields, jsonField{key: key, offset: keyStart, value: fieldValue})
+		}
+	case json.Delim('['):
+		v.kind = arrayKind
+		for p.dec.More() {
+			item, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			v.items = append(v.items, item)
+		}
+	default:
+		v.kind = scalarKind
+		v.raw = p.data[start:p.dec.InputOffset()]
+
+		return v, nil
+	}
+
+	// Consume the closing delimiter.
+	if _, err := p.dec.Token(); err != nil {
+		return nil, err
+	}
+	v.raw = p.data[start:p.dec.InputOffset()]
+
+	return v, nil
+}
+
+// syntaxError converts a decoder's error into a configSyntaxError.
+func (p *jsonParser) syntaxError(err error) error {
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &syntaxErr):
+		// The decoder's offset is just past the bad input, unless the input
+		// ended too soon.
+		offset := syntaxErr.Offset
+		if offset < int64(len(p.data)) {
+			offset = max(offset-1, 0)
+		}
+
+		return &configSyntaxError{msg: "invalid JSON: " + err.Error(), offset: offset}
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return &configSyntaxError{msg: "invalid JSON: unexpected end of JSON input", offset: int64(len(p.data))}
+	default:
+		return &configSyntaxError{msg: "invalid JSON: " + err.Error(), offset: p.start()}
+	}
+}
@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// lockEntry records the exact commit of a plugin after a successful sync.
+type lockEntry struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Branch string `json:"branch"`
+	Commit string `json:"commit"`
+}
+
+// lock represents the contents of a lockfile.
+type lock struct {
+	Plugins []lockEntry `json:"plugins"`
+}
+
+// lockPath returns the lockfile that belongs next to a config file. For
+// example, ~/.pluggo.json is paired with ~/.pluggo.lock.json.
+func lockPath(confFile string) string {
+	// The lockfile is always JSON, whatever the config's format.
+	return strings.TrimSuffix(confFile, filepath.Ext(confFile)) + ".lock.json"
+}
+
+// readLock loads the lockfile and returns its entries by plugin name.
+func (cmd *cmdEnv) readLock() (map[string]lockEntry, error) {
+	data, err := os.ReadFile(cmd.lockFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read lockfile %q: %w", cmd.lockFile, err)
+	}
+
+	var lk lock
+	if err := json.Unmarshal(data, &lk); err != nil {
+		return nil, fmt.Errorf("cannot parse lockfile %q: %w", cmd.lockFile, err)
+	}
+
+	entriesByName := make(map[string]lockEntry, len(lk.Plugins))
+	for _, entry := range lk.Plugins {
+		entriesByName[entry.Name] = entry
+	}
+
+	return entriesByName, nil
+}
+
+// writeLock records the current commit of every installed, configured plugin
+// whose repository matches the config. Plugins that this run left alone may
+// still have an old URL or branch or have commits that are not upstream, so
+// writeLock keeps their old entries, if any.
+func (cmd *cmdEnv) writeLock(ctx context.Context, pSpecs []pluginSpec) error {
+	leftAlone := make(map[string]bool)
+	for _, res := range cmd.results {
+		switch res.status {
+		case skipped, unmanaged, modified:
+			leftAlone[res.plugin] = true
+		}
+	}
+
+	lk := lock{Plugins: make([]lockEntry, 0, len(pSpecs))}
+	for _, pSpec := range pSpecs {
+		entry, ok := cmd.locked[pSpec.Name]
+		if !leftAlone[pSpec.Name] {
+			current, matches, err := cmd.currentLockEntry(ctx, pSpec)
+			if err != nil {
+				return err
+			}
+			if matches {
+				entry, ok = current, true
+			}
+		}
+
+		if ok {
+			lk.Plugins = append(lk.Plugins, entry)
+		}
+	}
+
+	slices.SortFunc(lk.Plugins, func(a, b lockEntry) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	data, err := json.MarshalIndent(lk, "", "    ")
+	if err != nil {
+		return fmt.Errorf("cannot encode lockfile: %w", err)
+	}
+	data = append(data, '\n')
+
+	return writeFileAtomic(cmd.lockFile, data)
+}
+
+// currentLockEntry returns a lockfile entry for a plugin's current commit. It
+// reports false if the plugin is not installed or its repository does not
+// match the config.
+func (cmd *cmdEnv) currentLockEntry(ctx context.Context, pSpec pluginSpec) (lockEntry, bool, error) {
+	// Commands like update leave missing plugins alone.
+	dir := cmd.pluginPath(pSpec)
+	if !isRepo(dir) {
+		return lockEntry{}, false, nil
+	}
+
+	url, err := cmd.git.repoURL(ctx, dir)
+	if err != nil {
+		return lockEntry{}, false, fmt.Errorf("cannot determine URL for %q: %w", pSpec.Name, err)
+	}
+
+	info, err := cmd.git.getBranchInfo(ctx, dir)
+	if err != nil {
+		return lockEntry{}, false, fmt.Errorf("cannot determine commit for %q: %w", pSpec.Name, err)
+	}
+
+	// A restore checks out the commit from the config's URL and branch, so
+	// the plugin must be on both.
+	if url != pSpec.URL || (pSpec.ref() == "" && pSpec.Branch != "" && info.branch != pSpec.Branch) {
+		cmd.debugf("%s: not locking %q: it does not match the config", cmd.name, pSpec.Name)
+		return lockEntry{}, false, nil
+	}
+
+	return lockEntry{
+		Name:   pSpec.Name,
+		URL:    pSpec.URL,
+		Branch: pSpec.Branch,
+		Commit: info.hash.String(),
+	}, true, nil
+}
+
+// lockedCommit returns the locked commit for a plugin if restore mode is on
+// and the lockfile has an entry that matches the plugin's URL and branch. A
+// plugin without such an entry is synced normally, which is not a failure. An
+// entry with an invalid commit is a failure, but the plugin is still synced
+// normally.
+func (cmd *cmdEnv) lockedCommit(pSpec pluginSpec) (digest, bool) {
+	if !cmd.restoreWanted {
+		return nil, false
+	}
+
+	entry, ok := cmd.locked[pSpec.Name]
+	if !ok {
+		cmd.debugf("%s: %q has no lockfile entry: syncing normally", cmd.name, pSpec.Name)
+		return nil, false
+	}
+
+	if entry.URL != pSpec.URL || entry.Branch != pSpec.Branch {
+		cmd.debugf("%s: lockfile entry for %q does not match config: syncing normally", cmd.name, pSpec.Name)
+		return nil, false
+	}
+
+	commit, err := checkDigest([]byte(entry.Commit))
+	if err != nil {
+		cmd.warnf("%s: lockfile entry for %q: %s: syncing normally", cmd.name, pSpec.Name, err)
+		return nil, false
+	}
+
+	return commit, true
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place.
+func writeFileAtomic(filename string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return fmt.Errorf("cannot create %q: %w", filename, err)
+	}
+
+	_, err = tmp.Write(data)
+	// Check Close as well, since it can report a failed write.
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		if removeErr := os.Remove(tmp.Name()); removeErr != nil {
+			err = errors.Join(err, removeErr)
+		}
+
+		return fmt.Errorf("cannot write %q: %w", filename, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLockPath(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		confFile string
+		expected string
+	}{
+		"json extension":  {confFile: "/home/u/.pluggo.json", expected: "/home/u/.pluggo.lock.json"},
+		"no extension":    {confFile: "/home/u/pluggo", expected: "/home/u/pluggo.lock.json"},
+		"toml extension":  {confFile: "/home/u/pluggo.toml", expected: "/home/u/pluggo.lock.json"},
+		"jsonc extension": {confFile: "/home/u/pluggo.jsonc", expected: "/home/u/pluggo.lock.json"},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := lockPath(tc.confFile); actual != tc.expected {
+				t.Errorf("lockPath(%q) = %q; want %q", tc.confFile, actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestReadLock(t *testing.T) {
+	t.Parallel()
+
+	cmd := fakeCmdEnv("testdata/plugins.json")
+	cmd.lockFile = "testdata/plugins.lock.json"
+
+	expected := map[string]lockEntry{
+		"bar.git": {
+			Name:   "bar.git",
+			URL:    "https://github.com/bar/bar.git",
+			Branch: "master",
+			Commit: "687d3f3169e20b9be772934616fad0c63331eda1",
+		},
+		"foo.git": {
+			Name:   "foo.git",
+			URL:    "https://github.com/foo/foo.git",
+			Branch: "foo",
+			Commit: "ae834f87c14e045584dcfa359d5bdfd3144f1e49",
+		},
+	}
+
+	actual, err := cmd.readLock()
+	if err != nil {
+		t.Fatalf("test cannot finish since cmd.readLock() failed: %v", err)
+	}
+
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("cmd.readLock() failure (-want +got)\n%s", diff)
+	}
+}
+
+func TestLockedCommitWithoutEntry(t *testing.T) {
+	t.Parallel()
+
+	cmd := fakeCmdEnv("testdata/plugins.json")
+	cmd.restoreWanted = true
+	cmd.locked = map[string]lockEntry{
+		"foo.git": {Name: "foo.git", URL: "https://github.com/foo/foo.git", Branch: "other", Commit: "abc"},
+	}
+
+	for _, pSpec := range makePlugins() {
+		if commit, ok := cmd.lockedCommit(pSpec); ok {
+			t.Errorf("cmd.lockedCommit(%q) = %q; want no commit", pSpec.Name, commit)
+		}
+	}
+
+	// Plugins without a matching entry are synced normally, which is not a
+	// failure.
+	if warnings := cmd.warnings.Load(); warnings != 0 {
+		t.Errorf("cmd.lockedCommit() counted %d warnings; want 0", warnings)
+	}
+}
+
+func TestLockedCommitWithInvalidCommit(t *testing.T) {
+	t.Parallel()
+
+	cmd := fakeCmdEnv("testdata/plugins.json")
+	cmd.restoreWanted = true
+	cmd.locked = map[string]lockEntry{
+		"foo.git": {Name: "foo.git", URL: "https://github.com/foo/foo.git", Branch: "foo", Commit: "--upload-pack=x"},
+	}
+
+	pSpec := makePlugins()[0]
+	if commit, ok := cmd.lockedCommit(pSpec); ok {
+		t.Errorf("cmd.lockedCommit(%q) = %q; want no commit", pSpec.Name, commit)
+	}
+
+	if warnings := cmd.warnings.Load(); warnings != 1 {
+		t.Errorf("cmd.lockedCommit() counted %d warnings; want 1", warnings)
+	}
+}
+
+func TestWriteLockKeepsEntriesOfPluginsLeftAlone(t *testing.T) {
+	t.Parallel()
+
+	remotes := newFakeGit()
+	remotes.commit(t, "foo", "main", "first foo")
+	remotes.commit(t, "bar", "main", "first bar")
+	remotes.commit(t, "baz", "main", "first baz")
+	remotes.mirror(t, "foo", "foo-mirror")
+
+	cmd := testSyncEnv(t, remotes.backend())
+	cmd.lockFile = filepath.Join(t.TempDir(), "pluggo.lock.json")
+	foo := pluginSpec{Name: "foo", URL: remotes.url("foo"), Branch: "main"}
+	bar := pluginSpec{Name: "bar", URL: remotes.url("bar"), Branch: "main"}
+	baz := pluginSpec{Name: "baz", URL: remotes.url("baz"), Branch: "main"}
+	first := syncAndLock(t, cmd, []pluginSpec{foo, bar, baz})
+
+	// Update skips a plugin whose URL changed, so foo keeps the old URL, and
+	// it leaves the locally modified baz at its old commit.
+	cmd.subcmd = "update"
+	cmd.locked = first
+	foo.URL = remotes.url("foo-mirror")
+	remotes.modify(t, cmd.pluginPath(baz))
+	remotes.commit(t, "baz", "main", "second baz")
+	remotes.commit(t, "bar", "main", "second bar")
+	second := syncAndLock(t, cmd, []pluginSpec{foo, bar, baz})
+
+	info, err := cmd.git.getBranchInfo(t.Context(), cmd.pluginPath(bar))
+	if err != nil {
+		t.Fatalf("test cannot finish since getBranchInfo() failed: %v", err)
+	}
+
+	expected := maps.Clone(first)
+	expected["bar"] = lockEntry{Name: "bar", URL: bar.URL, Branch: "main", Commit: info.hash.String()}
+	if expected["bar"] == first["bar"] {
+		t.Fatal("test cannot finish since update did not change bar")
+	}
+	if diff := cmp.Diff(expected, second); diff != "" {
+		t.Errorf("cmd.writeLock() failure (-want +got)\n%s", diff)
+	}
+}
+
+func TestWriteLockKeepsEntriesOfPluginsUpdateSkips(t *testing.T) {
+	t.Parallel()
+
+	remotes := newFakeGit()
+	remotes.commit(t, "foo", "main", "first foo")
+	remotes.commit(t, "foo", "dev", "first dev")
+	remotes.commit(t, "bar", "main", "first bar")
+
+	cmd := testSyncEnv(t, remotes.backend())
+	cmd.lockFile = filepath.Join(t.TempDir(), "pluggo.lock.json")
+	foo := pluginSpec{Name: "foo", URL: remotes.url("foo"), Branch: "main"}
+	bar := pluginSpec{Name: "bar", URL: remotes.url("bar"), Branch: "main"}
+	first := syncAndLock(t, cmd, []pluginSpec{foo, bar})
+
+	// Update does not switch foo to its new branch or reinstall bar.
+	cmd.subcmd = "update"
+	cmd.locked = first
+	foo.Branch = "dev"
+	if err := os.RemoveAll(cmd.pluginPath(bar)); err != nil {
+		t.Fatal(err)
+	}
+	second := syncAndLock(t, cmd, []pluginSpec{foo, bar})
+
+	if diff := cmp.Diff(first, second); diff != "" {
+		t.Errorf("cmd.writeLock() failure (-want +got)\n%s", diff)
+	}
+}
+
+// syncAndLock runs a sync, writes the lockfile, and returns what it holds.
+func syncAndLock(t *testing.T, cmd *cmdEnv, pSpecs []pluginSpec) map[string]lockEntry {
+	t.Helper()
+
+	runSync(t, cmd, pSpecs)
+	if err := cmd.writeLock(t.Context(), pSpecs); err != nil {
+		t.Fatalf("test cannot finish since cmd.writeLock() failed: %v", err)
+	}
+
+	locked, err := cmd.readLock()
+	if err != nil {
+		t.Fatalf("test cannot finish since cmd.readLock() failed: %v", err)
+	}
+
+	return locked
+}
+
+func TestWriteFileAtomicRemovesTempFile(t *testing.T) {
+	t.Parallel()
+
+	// Renaming a file over a directory that is not empty fails everywhere.
+	dir := t.TempDir()
+	target := filepath.Join(dir, "pluggo.lock")
+	if err := os.MkdirAll(filepath.Join(target, "sub"), 0o755); err != nil {
+		t.Fatalf("test cannot finish since os.MkdirAll() failed: %v", err)
+	}
+
+	if err := writeFileAtomic(target, []byte("{}")); err == nil {
+		t.Fatalf("writeFileAtomic(%q) succeeded; want an error", target)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("test cannot finish since os.ReadDir() failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("writeFileAtomic(%q) left %d entries in %q; want 1", target, len(entries), dir)
+	}
+}
@@ -2,34 +2,217 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
-	"strings"
+	"path/filepath"
 )
 
-// reinstall removes and re-clones a plugin repository.
-func (cmd *cmdEnv) reinstall(ctx context.Context, dir string, pSpec pluginSpec) error {
-	// Verify dir is within expected plugin directories
-	if !strings.HasPrefix(dir, cmd.startDir) && !strings.HasPrefix(dir, cmd.optDir) {
-		return fmt.Errorf("refusing to remove directory outside plugin paths: %s", dir)
+// reinstall replaces a plugin with a fresh clone. The old copy stays in place
+// until the new clone is ready, so a failed clone leaves the plugin as it was.
+func (cmd *cmdEnv) reinstall(ctx context.Context, dir string, pSpec pluginSpec, locked digest) error {
+	target := cmd.pluginPath(pSpec)
+	for _, path := range []string{dir, target} {
+		if err := cmd.checkPluginPath(path); err != nil {
+			return err
+		}
 	}
 
-	if err := os.RemoveAll(dir); err != nil {
-		return fmt.Errorf("failed to remove existing directory: %w", err)
+	staged, cleanup, err := cmd.stage(ctx, pSpec, locked)
+	defer cleanup()
+	if err != nil {
+		return err
 	}
 
-	return clone(ctx, pSpec.URL, pSpec.Branch, cmd.pluginPath(pSpec))
+	// Set the old copy aside in the staging directory, so that cleanup
+	// removes it once the new clone is in place.
+	old := staged + ".old"
+	if err := os.Rename(dir, old); err != nil {
+		return fmt.Errorf("cannot move existing directory aside: %w", err)
+	}
+
+	if err := os.Rename(staged, target); err != nil {
+		if restoreErr := os.Rename(old, dir); restoreErr != nil {
+			return fmt.Errorf("cannot move new clone into place: %w (and cannot restore %q: %w)", err, dir, restoreErr)
+		}
+
+		return fmt.Errorf("cannot move new clone into place: %w", err)
+	}
+
+	return nil
+}
+
+// switchInPlace points a plugin at its new URL or branch without cloning it
+// again. It reports false, having changed nothing, if the new URL has no
+// history in common with the old one; such a plugin must be reinstalled.
+func (cmd *cmdEnv) switchInPlace(ctx context.Context, pState *pluginState, pSpec pluginSpec, locked digest) (bool, error) {
+	dir := pState.directory
+	urlChanged := pState.url != pSpec.URL
+	if urlChanged {
+		// Fetching from an unrelated repository would download it in full,
+		// and then reinstall would download it again. Ask the new URL about
+		// its branches and tags first. A remote with none of our commits
+		// at a branch or tag is treated as unrelated: if it is not, all
+		// its refs have moved on, and a fresh clone costs little more.
+		var shared bool
+		err := cmd.retry(ctx, pSpec.Name, cmd.timeoutsFor(pSpec).Update, func(ctx context.Context) error {
+			var err error
+			shared, err = cmd.git.sharesCommits(ctx, dir, pSpec.URL)
+
+			return err
+		})
+		if err != nil || !shared {
+			return false, err
+		}
+
+		if err := cmd.git.setURL(ctx, dir, pSpec.URL); err != nil {
+			return false, err
+		}
+	}
+
+	shared, err := cmd.switchTo(ctx, pState, pSpec)
+	if urlChanged && (err != nil || !shared) {
+		// Leave the plugin as it was.
+		if restoreErr := cmd.git.setURL(ctx, dir, pState.url); restoreErr != nil {
+			return false, errors.Join(err, fmt.Errorf("cannot restore URL %q: %w", pState.url, restoreErr))
+		}
+	}
+	if err != nil || !shared {
+		return false, err
+	}
+
+	if locked != nil && pSpec.ref() == "" {
+		return true, cmd.restore(ctx, dir, pSpec, locked)
+	}
+
+	return true, cmd.updateSubmodules(ctx, dir, pSpec)
+}
+
+// switchTo fetches the commit that a plugin should have and, if it shares
+// history with what the plugin has now, checks it out. It reports whether the
+// histories are shared.
+func (cmd *cmdEnv) switchTo(ctx context.Context, pState *pluginState, pSpec pluginSpec) (bool, error) {
+	dir := pState.directory
+	ref := pSpec.ref()
+
+	var branch string
+	var target digest
+	var err error
+	if ref != "" {
+		err = cmd.retry(ctx, pSpec.Name, cmd.timeoutsFor(pSpec).Update, func(ctx context.Context) error {
+			target, err = cmd.git.fetchRef(ctx, dir, ref)
+
+			return err
+		})
+	} else {
+		branch, target, err = cmd.fetchBranch(ctx, dir, pSpec)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	shared, err := cmd.git.sharesHistory(ctx, dir, pState.hash, target)
+	if err != nil || !shared {
+		return false, err
+	}
+
+	return true, cmd.retry(ctx, pSpec.Name, cmd.timeoutsFor(pSpec).Update, func(ctx context.Context) error {
+		if ref != "" {
+			return cmd.git.checkoutRef(ctx, dir, ref)
+		}
+
+		return cmd.git.switchBranch(ctx, dir, branch)
+	})
+}
+
+// install clones a plugin and moves it into place once the clone is ready.
+func (cmd *cmdEnv) install(ctx context.Context, pSpec pluginSpec, locked digest) error {
+	target := cmd.pluginPath(pSpec)
+	if err := cmd.checkPluginPath(target); err != nil {
+		return err
+	}
+
+	staged, cleanup, err := cmd.stage(ctx, pSpec, locked)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(staged, target); err != nil {
+		return fmt.Errorf("cannot move new clone into place: %w", err)
+	}
+
+	return nil
+}
+
+// stage clones a plugin into a new directory under the staging directory and
+// checks out the commit that it is pinned or locked to, if any. stage returns
+// the clone's path and a function that removes whatever stage created.
+func (cmd *cmdEnv) stage(ctx context.Context, pSpec pluginSpec, locked digest) (string, func(), error) {
+	tmpDir, err := os.MkdirTemp(cmd.stagingDir, "clone-*")
+	if err != nil {
+		return "", func() {}, fmt.Errorf("cannot create staging directory: %w", err)
+	}
+	cleanup := func() {
+		// A leftover staging directory is removed on the next sync.
+		if err := os.RemoveAll(tmpDir); err != nil {
+			cmd.debugf("%s: cannot remove %q: %s", cmd.name, tmpDir, err)
+		}
+	}
+	dir := filepath.Join(tmpDir, pSpec.Name)
+	if err := cmd.checkStagingPath(dir); err != nil {
+		return "", cleanup, err
+	}
+
+	// Git can clone a tag directly, but not a commit.
+	branch := pSpec.Branch
+	if pSpec.Tag != "" {
+		branch = pSpec.Tag
+	}
+
+	err = cmd.retry(ctx, pSpec.Name, cmd.timeoutsFor(pSpec).Clone, func(ctx context.Context) error {
+		// A failed attempt may leave a partial clone behind.
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+
+		return cmd.git.clone(ctx, pSpec.URL, branch, dir)
+	})
+	if err != nil {
+		return "", cleanup, err
+	}
+
+	switch {
+	case pSpec.Commit != "":
+		err = cmd.checkout(ctx, dir, pSpec)
+	case locked != nil:
+		err = cmd.restore(ctx, dir, pSpec, locked)
+	default:
+		err = cmd.updateSubmodules(ctx, dir, pSpec)
+	}
+	if err != nil {
+		return "", cleanup, err
+	}
+
+	return dir, cleanup, nil
 }
 
 // move relocates a plugin, returning where the plugin was moved and any error.
 func (cmd *cmdEnv) move(pState *pluginState, pSpec pluginSpec) (string, error) {
-	targetPath := cmd.pluginPath(pSpec)
+	movedTo := cmd.moveTarget(pState, pSpec)
 
 	// Return early if no move is needed.
-	if targetPath == pState.directory {
+	if movedTo == "" {
 		return "", nil
 	}
 
+	targetPath := cmd.pluginPath(pSpec)
+	for _, path := range []string{pState.directory, targetPath} {
+		if err := cmd.checkPluginPath(path); err != nil {
+			return "", err
+		}
+	}
+
 	if err := os.Rename(pState.directory, targetPath); err != nil {
 		return "", err
 	}
@@ -37,25 +220,207 @@ func (cmd *cmdEnv) move(pState *pluginState, pSpec pluginSpec) (string, error) {
 	// Update state with new location.
 	pState.directory = targetPath
 
+	return movedTo, nil
+}
+
+// moveTarget returns "start" or "opt" if a plugin must move to match its spec
+// and "" if it is already in the right place.
+func (cmd *cmdEnv) moveTarget(pState *pluginState, pSpec pluginSpec) string {
+	if cmd.pluginPath(pSpec) == pState.directory {
+		return ""
+	}
+
 	if pSpec.Opt {
-		return "opt", nil
+		return "opt"
 	}
 
-	return "start", nil
+	return "start"
 }
 
-func (cmd *cmdEnv) update(ctx context.Context, pState *pluginState) error {
-	return pull(ctx, pState.directory)
+// update fetches a plugin's branch and moves the plugin to the branch's new
+// tip, even if the upstream branch was rewritten (e.g., by a force push).
+// Unless --force was given, update leaves a plugin with local changes alone
+// and returns a *localChangesError. update returns a note for the report when
+// history was rewritten or the remote's default branch changed.
+func (cmd *cmdEnv) update(ctx context.Context, pState *pluginState, pSpec pluginSpec) (string, error) {
+	// After the fetch, commits that upstream dropped would look unpushed.
+	if err := cmd.checkUnpushed(ctx, pState, pSpec); err != nil {
+		return "", err
+	}
+
+	branch, tip, err := cmd.fetchBranch(ctx, pState.directory, pSpec)
+	if err != nil {
+		return "", err
+	}
+
+	if branch != pState.branch {
+		if err := cmd.keepChanges(ctx, pState, pSpec); err != nil {
+			return "", err
+		}
+
+		return cmd.followDefault(ctx, pState, pSpec, branch)
+	}
+
+	// Submodules may be missing even if the plugin is up to date, e.g., if
+	// updating them failed last time.
+	if tip.equals(pState.hash) {
+		return "", cmd.updateSubmodules(ctx, pState.directory, pSpec)
+	}
+
+	fastForward, err := cmd.git.isAncestor(ctx, pState.directory, pState.hash, tip)
+	if err != nil {
+		return "", err
+	}
+
+	if err := cmd.keepChanges(ctx, pState, pSpec); err != nil {
+		return "", err
+	}
+
+	if err := cmd.git.resetTo(ctx, pState.directory, tip); err != nil {
+		return "", err
+	}
+
+	var note string
+	if !fastForward {
+		note = "history rewritten"
+	}
+
+	return note, cmd.updateSubmodules(ctx, pState.directory, pSpec)
+}
+
+// localChangesError reports that pluggo left a plugin alone to keep its local
+// changes.
+type localChangesError struct {
+	changes string
+}
+
+func (e *localChangesError) Error() string {
+	return "plugin has " + e.changes
+}
+
+// keepChanges checks a plugin for local changes just before pluggo would
+// discard them. It returns a *localChangesError if the plugin has any and
+// --force was not given.
+func (cmd *cmdEnv) keepChanges(ctx context.Context, pState *pluginState, pSpec pluginSpec) error {
+	if err := cmd.checkLocal(ctx, pState, pSpec); err != nil {
+		return err
+	}
+
+	if changes := pState.localChanges(pSpec); changes != "" && !cmd.forceWanted {
+		return &localChangesError{changes: changes}
+	}
+
+	return nil
 }
 
-// hasConfigChanged checks whether a plugin should be reinstalled.
+// fetchBranch fetches the branch that a plugin follows and returns the
+// branch's name and tip. A plugin without a branch follows the remote's
+// default branch.
+func (cmd *cmdEnv) fetchBranch(ctx context.Context, dir string, pSpec pluginSpec) (string, digest, error) {
+	branch := pSpec.Branch
+	var tip digest
+	err := cmd.retry(ctx, pSpec.Name, cmd.timeoutsFor(pSpec).Update, func(ctx context.Context) error {
+		var err error
+		if pSpec.Branch == "" {
+			if branch, err = cmd.git.defaultBranch(ctx, dir); err != nil {
+				return err
+			}
+		}
+		tip, err = cmd.git.fetch(ctx, dir, branch)
+
+		return err
+	})
+
+	return branch, tip, err
+}
+
+// followDefault switches a plugin without a branch to the remote's new default
+// branch.
+func (cmd *cmdEnv) followDefault(ctx context.Context, pState *pluginState, pSpec pluginSpec, branch string) (string, error) {
+	err := cmd.retry(ctx, pSpec.Name, cmd.timeoutsFor(pSpec).Update, func(ctx context.Context) error {
+		return cmd.git.switchBranch(ctx, pState.directory, branch)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	note := fmt.Sprintf("default branch changed from %s to %s", pState.branch, branch)
+
+	return note, cmd.updateSubmodules(ctx, pState.directory, pSpec)
+}
+
+// checkout moves a plugin to the commit or tag that it is pinned to.
+func (cmd *cmdEnv) checkout(ctx context.Context, dir string, pSpec pluginSpec) error {
+	err := cmd.retry(ctx, pSpec.Name, cmd.timeoutsFor(pSpec).Update, func(ctx context.Context) error {
+		return cmd.git.checkoutRef(ctx, dir, pSpec.ref())
+	})
+	if err != nil {
+		return err
+	}
+
+	return cmd.updateSubmodules(ctx, dir, pSpec)
+}
+
+// restore moves a plugin to its locked commit.
+func (cmd *cmdEnv) restore(ctx context.Context, dir string, pSpec pluginSpec, commit digest) error {
+	err := cmd.retry(ctx, pSpec.Name, cmd.timeoutsFor(pSpec).Update, func(ctx context.Context) error {
+		return cmd.git.resetTo(ctx, dir, commit)
+	})
+	if err != nil {
+		return err
+	}
+
+	return cmd.updateSubmodules(ctx, dir, pSpec)
+}
+
+// updateSubmodules brings a plugin's submodules in line with its checked-out
+// commit, unless the plugin opts out.
+func (cmd *cmdEnv) updateSubmodules(ctx context.Context, dir string, pSpec pluginSpec) error {
+	if pSpec.SkipSubmodules {
+		return nil
+	}
+
+	return cmd.retry(ctx, pSpec.Name, cmd.timeoutsFor(pSpec).Update, func(ctx context.Context) error {
+		return cmd.git.updateSubmodules(ctx, dir)
+	})
+}
+
+// hasConfigChanged checks whether a plugin needs a new URL or branch.
 func (cmd *cmdEnv) hasConfigChanged(pState *pluginState, pSpec pluginSpec) (bool, string) {
 	switch {
 	case pState.url != pSpec.URL:
 		return true, "plugin URL changed"
+	case pSpec.ref() != "":
+		// Plugins pinned to a commit or tag ignore branches.
+		return false, ""
+	case pState.branch == "" && pSpec.Branch == "":
+		return true, "switching from detached HEAD to the default branch"
+	case pState.branch == "":
+		return true, "switching from detached HEAD to branch " + pSpec.Branch
+	case pSpec.Branch == "":
+		// Update follows the remote's default branch, which only the
+		// remote knows.
+		return false, ""
 	case pState.branch != pSpec.Branch:
 		return true, fmt.Sprintf("switching from branch %s to %s", pState.branch, pSpec.Branch)
 	default:
 		return false, ""
 	}
 }
+
+// hasRefChanged checks whether a plugin pinned to a commit or tag must be
+// checked out at a different commit.
+func (cmd *cmdEnv) hasRefChanged(pState *pluginState, pSpec pluginSpec) (bool, string) {
+	switch {
+	case pSpec.Commit != "":
+		if !pState.atCommit(pSpec.Commit) {
+			return true, "commit " + pSpec.Commit
+		}
+	case pSpec.Tag != "":
+		if pState.branch != "" || !pState.tagCommit.equals(pState.hash) {
+			return true, "tag " + pSpec.Tag
+		}
+	}
+
+	return false, ""
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// checkPluginPath reports an error unless path is strictly inside start/ or
+// opt/. Pluggo checks every plugin directory that it removes, renames, or moves
+// a clone into.
+func (cmd *cmdEnv) checkPluginPath(path string) error {
+	return checkContained(path, cmd.startDir, cmd.optDir)
+}
+
+// checkStagingPath reports an error unless path is strictly inside the staging
+// directory.
+func (cmd *cmdEnv) checkStagingPath(path string) error {
+	return checkContained(path, cmd.stagingDir)
+}
+
+// checkContained reports an error unless path is strictly inside one of roots.
+// The last element of path must be a valid plugin name, and its parent must
+// resolve, after symlinks, to one of roots or a directory inside one. The last
+// element itself may be a symlink since removing or renaming a symlink leaves
+// its target alone.
+func checkContained(path string, roots ...string) error {
+	if err := checkName(filepath.Base(path)); err != nil {
+		return fmt.Errorf("refusing to use %q: %w", path, err)
+	}
+
+	parent, err := resolvePath(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("refusing to use %q: %w", path, err)
+	}
+
+	for _, root := range roots {
+		resolvedRoot, err := resolvePath(root)
+		if err != nil {
+			continue
+		}
+
+		if isWithin(resolvedRoot, parent) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("refusing to use %q: outside the plugin directories", path)
+}
+
+// resolvePath returns the absolute path of an existing file or directory with
+// all symlinks resolved.
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.EvalSymlinks(abs)
+}
+
+// isWithin reports whether path is root or a directory inside it. Both must be
+// clean, absolute paths.
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
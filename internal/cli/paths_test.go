@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckContained(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	start := filepath.Join(root, "start")
+	outside := filepath.Join(root, "outside")
+	for _, dir := range []string{start, filepath.Join(root, "startx"), outside} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatalf("test cannot finish since os.Mkdir(%q) failed: %v", dir, err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(start, "link")); err != nil {
+		t.Fatalf("test cannot finish since os.Symlink failed: %v", err)
+	}
+	linkedStart := filepath.Join(root, "linked-start")
+	if err := os.Symlink(start, linkedStart); err != nil {
+		t.Fatalf("test cannot finish since os.Symlink failed: %v", err)
+	}
+
+	tests := map[string]struct {
+		path string
+		ok   bool
+	}{
+		"inside":              {path: filepath.Join(start, "plugin"), ok: true},
+		"symlink itself":      {path: filepath.Join(start, "link"), ok: true},
+		"through linked root": {path: filepath.Join(linkedStart, "plugin"), ok: true},
+		"root itself":         {path: start, ok: false},
+		"sibling with prefix": {path: filepath.Join(root, "startx", "plugin"), ok: false},
+		"parent element":      {path: start + "/../outside/plugin", ok: false},
+		"ends in parent":      {path: start + "/plugin/..", ok: false},
+		"through symlink":     {path: filepath.Join(start, "link", "plugin"), ok: false},
+		"missing parent":      {path: filepath.Join(start, "nope", "plugin"), ok: false},
+		"outside altogether":  {path: filepath.Join(outside, "plugin"), ok: false},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			err := checkContained(tc.path, start)
+			if tc.ok && err != nil {
+				t.Errorf("checkContained(%q) failed: %v", tc.path, err)
+			}
+			if !tc.ok && err == nil {
+				t.Errorf("checkContained(%q) expected error", tc.path)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package cli
+
+import (
+	"maps"
+	"slices"
+)
+
+// actionKind describes what will be done to a plugin.
+type actionKind uint8
+
+const (
+	installAction actionKind = iota
+	switchAction
+	updateAction
+	checkoutAction
+	removeAction
+	skipAction
+	keepAction
+	modifiedAction
+)
+
+// action is a single planned change to a plugin.
+type action struct {
+	pState *pluginState // nil if the plugin is not installed
+	plugin string
+	reason string     // Why the plugin is switched, checked out, skipped, or left alone
+	moveTo string     // "start" or "opt"; "" if no move
+	commit digest     // locked commit in restore mode; nil otherwise
+	pSpec  pluginSpec // zero value for removals
+	kind   actionKind
+}
+
+// plan lists every action needed to carry out a command. Removals are kept
+// apart since they run before everything else.
+type plan struct {
+	removals []action
+	actions  []action
+}
+
+// makePlan computes the plan for the current command.
+func (cmd *cmdEnv) makePlan(statesByName map[string]*pluginState, pSpecs []pluginSpec) plan {
+	switch cmd.subcmd {
+	case "install":
+		return cmd.planInstall(statesByName, pSpecs)
+	case "update":
+		return cmd.planUpdate(statesByName, pSpecs)
+	case "clean":
+		removals, kept := cmd.planRemovals(statesByName, pSpecs)
+
+		return plan{removals: removals, actions: kept}
+	default:
+		return cmd.planSync(statesByName, pSpecs)
+	}
+}
+
+// planSync plans a full sync: remove unwanted plugins, then install, reinstall,
+// move, or update every plugin in the config.
+func (cmd *cmdEnv) planSync(statesByName map[string]*pluginState, pSpecs []pluginSpec) plan {
+	removals, kept := cmd.planRemovals(statesByName, pSpecs)
+	p := plan{
+		removals: removals,
+		actions:  slices.Grow(kept, len(pSpecs)),
+	}
+
+	for _, pSpec := range pSpecs {
+		p.actions = append(p.actions, cmd.planPlugin(statesByName[pSpec.Name], pSpec))
+	}
+
+	return p
+}
+
+// planInstall plans to install only the plugins that are missing locally.
+func (cmd *cmdEnv) planInstall(statesByName map[string]*pluginState, pSpecs []pluginSpec) plan {
+	var p plan
+
+	for _, pSpec := range pSpecs {
+		if statesByName[pSpec.Name] == nil {
+			p.actions = append(p.actions, cmd.planPlugin(nil, pSpec))
+		}
+	}
+
+	return p
+}
+
+// planUpdate plans to update installed plugins in place, skipping plugins that
+// are not installed or whose URL or branch changed.
+func (cmd *cmdEnv) planUpdate(statesByName map[string]*pluginState, pSpecs []pluginSpec) plan {
+	p := plan{actions: make([]action, 0, len(pSpecs))}
+
+	for _, pSpec := range pSpecs {
+		act := cmd.planPlugin(statesByName[pSpec.Name], pSpec)
+
+		switch act.kind {
+		case installAction:
+			act.kind = skipAction
+			act.reason = "not installed"
+		case switchAction:
+			act.kind = skipAction
+			act.reason += "; run sync to switch"
+			act.moveTo = ""
+		default:
+			act.moveTo = ""
+		}
+
+		p.actions = append(p.actions, act)
+	}
+
+	return p
+}
+
+// planPlugin is the main decision tree for a single plugin: if not installed,
+// install; if locally modified, leave it alone (unless forced); if URL or
+// branch changed, move (if needed) and switch in place; if pinned to a
+// different commit or tag, move (if needed) and check it out; otherwise move
+// (if needed) and update (unless pinned).
+func (cmd *cmdEnv) planPlugin(pState *pluginState, pSpec pluginSpec) action {
+	act := action{
+		pState: pState,
+		pSpec:  pSpec,
+		plugin: pSpec.Name,
+	}
+
+	// Plugins pinned to a commit or tag are already exact.
+	if pSpec.ref() == "" {
+		if commit, ok := cmd.lockedCommit(pSpec); ok {
+			act.commit = commit
+		}
+	}
+
+	// Plugin not installed locally: clone it.
+	if pState == nil {
+		act.kind = installAction
+		return act
+	}
+
+	// Local modifications would be lost or get in the way: leave the plugin
+	// alone unless forced.
+	if changes := pState.localChanges(pSpec); changes != "" && !cmd.forceWanted {
+		act.kind = modifiedAction
+		act.reason = changes
+
+		return act
+	}
+
+	// URL or branch have changed: move if needed, then switch in place.
+	act.moveTo = cmd.moveTarget(pState, pSpec)
+	if changed, reason := cmd.hasConfigChanged(pState, pSpec); changed {
+		act.kind = switchAction
+		act.reason = reason
+
+		return act
+	}
+
+	// Pinned commit or tag changed: move if needed, then check it out.
+	if changed, reason := cmd.hasRefChanged(pState, pSpec); changed {
+		act.kind = checkoutAction
+		act.reason = reason
+
+		return act
+	}
+
+	// URL and branch unchanged: move if needed, then update if not pinned.
+	act.kind = updateAction
+
+	return act
+}
+
+// planRemovals plans to remove plugins installed locally but not in the
+// config. Plugins in the keep list are never removed, nor are locally modified
+// plugins (unless forced). planRemovals returns the plugins it leaves alone
+// separately so that they can be reported.
+func (cmd *cmdEnv) planRemovals(statesByName map[string]*pluginState, pSpecs []pluginSpec) ([]action, []action) {
+	unwanted := findUnwanted(statesByName, makeSpecMap(pSpecs))
+	removals := make([]action, 0, len(unwanted))
+	var kept []action
+
+	for _, pluginName := range slices.Sorted(maps.Keys(unwanted)) {
+		act := action{
+			pState: statesByName[pluginName],
+			plugin: pluginName,
+			kind:   removeAction,
+		}
+
+		if cmd.isKept(pluginName) {
+			act.kind = keepAction
+			kept = append(kept, act)
+
+			continue
+		}
+
+		if changes := act.pState.localChanges(pluginSpec{}); changes != "" && !cmd.forceWanted {
+			act.kind = modifiedAction
+			act.reason = changes
+			kept = append(kept, act)
+
+			continue
+		}
+
+		removals = append(removals, act)
+	}
+
+	return removals, kept
+}
@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func fakePlanEnv(subcmd string) *cmdEnv {
+	return &cmdEnv{
+		name:     "test",
+		subcmd:   subcmd,
+		startDir: filepath.Join("pack", "start"),
+		optDir:   filepath.Join("pack", "opt"),
+	}
+}
+
+func fakeStates() map[string]*pluginState {
+	return map[string]*pluginState{
+		"foo.git": {
+			name:      "foo.git",
+			directory: filepath.Join("pack", "start", "foo.git"),
+			url:       "https://github.com/foo/foo.git",
+			branch:    "main",
+		},
+		"bar.git": {
+			name:      "bar.git",
+			directory: filepath.Join("pack", "start", "bar.git"),
+			url:       "https://github.com/bar/bar.git",
+			branch:    "master",
+		},
+		"old.git": {
+			name:      "old.git",
+			directory: filepath.Join("pack", "opt", "old.git"),
+			url:       "https://github.com/old/old.git",
+			branch:    "main",
+		},
+	}
+}
+
+// summarize flattens a plan so that tests can compare it easily.
+func summarize(p plan) []action {
+	summary := make([]action, 0, len(p.removals)+len(p.actions))
+	for _, act := range slices.Concat(p.removals, p.actions) {
+		summary = append(summary, action{
+			plugin: act.plugin,
+			kind:   act.kind,
+			reason: act.reason,
+			moveTo: act.moveTo,
+		})
+	}
+
+	return summary
+}
+
+func TestMakePlan(t *testing.T) {
+	t.Parallel()
+
+	pSpecs := []pluginSpec{
+		{URL: "https://github.com/foo/foo.git", Name: "foo.git", Branch: "foo"},
+		{URL: "https://github.com/bar/bar.git", Name: "bar.git", Branch: "master", Opt: true},
+		{URL: "https://example.com/buzz/fizz.git", Name: "random.git", Branch: "main"},
+	}
+
+	tests := map[string]struct {
+		subcmd   string
+		keep     []string
+		expected []action
+	}{
+		"sync": {
+			subcmd: "sync",
+			expected: []action{
+				{plugin: "old.git", kind: removeAction},
+				{plugin: "foo.git", kind: switchAction, reason: "switching from branch main to foo"},
+				{plugin: "bar.git", kind: updateAction, moveTo: "opt"},
+				{plugin: "random.git", kind: installAction},
+			},
+		},
+		"install": {
+			subcmd: "install",
+			expected: []action{
+				{plugin: "random.git", kind: installAction},
+			},
+		},
+		"update": {
+			subcmd: "update",
+			expected: []action{
+				{plugin: "foo.git", kind: skipAction, reason: "switching from branch main to foo; run sync to switch"},
+				{plugin: "bar.git", kind: updateAction},
+				{plugin: "random.git", kind: skipAction, reason: "not installed"},
+			},
+		},
+		"clean": {
+			subcmd: "clean",
+			expected: []action{
+				{plugin: "old.git", kind: removeAction},
+			},
+		},
+		"sync with keep": {
+			subcmd: "sync",
+			keep:   []string{"old*"},
+			expected: []action{
+				{plugin: "old.git", kind: keepAction},
+				{plugin: "foo.git", kind: switchAction, reason: "switching from branch main to foo"},
+				{plugin: "bar.git", kind: updateAction, moveTo: "opt"},
+				{plugin: "random.git", kind: installAction},
+			},
+		},
+		"clean with keep": {
+			subcmd: "clean",
+			keep:   []string{"new.git", "old.git"},
+			expected: []action{
+				{plugin: "old.git", kind: keepAction},
+			},
+		},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			cmd := fakePlanEnv(tc.subcmd)
+			cmd.keep = tc.keep
+			actual := summarize(cmd.makePlan(fakeStates(), pSpecs))
+
+			if diff := cmp.Diff(tc.expected, actual, cmp.AllowUnexported(action{})); diff != "" {
+				t.Errorf("cmd.makePlan() for %q failure (-want +got)\n%s", tc.subcmd, diff)
+			}
+		})
+	}
+}
+
+func TestMakePlanLocallyModified(t *testing.T) {
+	t.Parallel()
+
+	pSpecs := []pluginSpec{
+		{URL: "https://github.com/foo/foo.git", Name: "foo.git", Branch: "foo"},
+		{URL: "https://github.com/bar/bar.git", Name: "bar.git", Branch: "master"},
+	}
+
+	tests := map[string]struct {
+		expected []action
+		force    bool
+	}{
+		"not forced": {
+			expected: []action{
+				{plugin: "old.git", kind: modifiedAction, reason: "unpushed commits"},
+				{plugin: "foo.git", kind: modifiedAction, reason: "uncommitted changes"},
+				{plugin: "bar.git", kind: updateAction},
+			},
+		},
+		"forced": {
+			force: true,
+			expected: []action{
+				{plugin: "old.git", kind: removeAction},
+				{plugin: "foo.git", kind: switchAction, reason: "switching from branch main to foo"},
+				{plugin: "bar.git", kind: updateAction},
+			},
+		},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			statesByName := fakeStates()
+			statesByName["foo.git"].dirty = true
+			statesByName["old.git"].unpushed = true
+
+			cmd := fakePlanEnv("sync")
+			cmd.forceWanted = tc.force
+			actual := summarize(cmd.makePlan(statesByName, pSpecs))
+
+			if diff := cmp.Diff(tc.expected, actual, cmp.AllowUnexported(action{})); diff != "" {
+				t.Errorf("cmd.makePlan() failure (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHasRefChanged(t *testing.T) {
+	t.Parallel()
+
+	detached := &pluginState{
+		hash:      digest("130e0427badfab6b587567d6bad3c06d44a373a5"),
+		tagCommit: digest("130e0427badfab6b587567d6bad3c06d44a373a5"),
+	}
+	tagMoved := &pluginState{
+		hash:      digest("130e0427badfab6b587567d6bad3c06d44a373a5"),
+		tagCommit: digest("2e32312b5b0fb7a9a7a4b0d8e2ef3f4e6a1c9d07"),
+	}
+	noTag := &pluginState{
+		hash: digest("130e0427badfab6b587567d6bad3c06d44a373a5"),
+	}
+	onBranch := &pluginState{
+		branch: "main",
+		hash:   digest("130e0427badfab6b587567d6bad3c06d44a373a5"),
+	}
+
+	tests := map[string]struct {
+		pState   *pluginState
+		pSpec    pluginSpec
+		expected bool
+	}{
+		"same commit":           {pState: detached, pSpec: pluginSpec{Commit: "130e0427badfab6b587567d6bad3c06d44a373a5"}},
+		"abbreviated commit":    {pState: detached, pSpec: pluginSpec{Commit: "130e042"}},
+		"different commit":      {pState: detached, pSpec: pluginSpec{Commit: "2e32312"}, expected: true},
+		"same tag":              {pState: detached, pSpec: pluginSpec{Tag: "v1.0.0"}},
+		"tag at another commit": {pState: tagMoved, pSpec: pluginSpec{Tag: "v2.0.0"}, expected: true},
+		"tag not fetched":       {pState: noTag, pSpec: pluginSpec{Tag: "v2.0.0"}, expected: true},
+		"commit from a branch":  {pState: onBranch, pSpec: pluginSpec{Commit: "130e042"}, expected: true},
+		"no ref":                {pState: onBranch, pSpec: pluginSpec{Branch: "main"}},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			cmd := fakePlanEnv("sync")
+			if actual, _ := cmd.hasRefChanged(tc.pState, tc.pSpec); actual != tc.expected {
+				t.Errorf("cmd.hasRefChanged(%+v) = %t; want %t", tc.pSpec, actual, tc.expected)
+			}
+		})
+	}
+}
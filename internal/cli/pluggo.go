@@ -26,6 +26,15 @@ func Pluggo(args []string) int {
 		return 0
 	}
 
+	// Check the config without touching any plugins.
+	if cmd.subcmd == "validate" {
+		if !cmd.validate() {
+			return 1
+		}
+
+		return 0
+	}
+
 	// Listen for SIGINT (Ctrl+C).
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
@@ -49,13 +58,44 @@ func Pluggo(args []string) int {
 }
 
 func (cmd *cmdEnv) process(ctx context.Context, pSpecs []pluginSpec) error {
-	rep := newReporter("    ", cmd.quietWanted)
+	rep := newReporter("    ", cmd)
+
+	switch cmd.subcmd {
+	case "list":
+		cmd.list(pSpecs)
+		return nil
+	case "status":
+		cmd.status(ctx, pSpecs, rep)
+		return nil
+	}
+
+	statesByName, err := cmd.prepare(ctx, rep, pSpecs)
+	if err != nil {
+		return err
+	}
+
+	p := cmd.makePlan(statesByName, pSpecs)
+
+	if cmd.dryRunWanted {
+		return rep.finishPlan(p)
+	}
 
-	if err := cmd.sync(ctx, pSpecs, rep); err != nil {
+	cmd.execute(ctx, p)
+	if err := rep.finish(cmd.results); err != nil {
 		return err
 	}
 
-	rep.finish(cmd.results)
+	// Removing plugins does not change any commits.
+	if cmd.subcmd == "clean" {
+		return nil
+	}
+
+	// Record exact commits only when every plugin was processed successfully.
+	for _, res := range cmd.results {
+		if res.err != nil {
+			return nil
+		}
+	}
 
-	return nil
+	return cmd.writeLock(ctx, pSpecs)
 }
@@ -1,12 +1,91 @@
 package cli
 
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
 // pluginSpec represents a plugin specified in the user's configuration file.
 type pluginSpec struct {
-	URL    string `json:"url"`
-	Name   string `json:"name"`
-	Branch string `json:"branch"`
-	Opt    bool   `json:"opt,omitempty"`
-	Pinned bool   `json:"pin,omitempty"`
+	URL     string   `json:"url"`
+	Name    string   `json:"name"`
+	Branch  string   `json:"branch"` // "" to follow the remote's default branch
+	Commit  string   `json:"commit,omitempty"`
+	Tag     string   `json:"tag,omitempty"`
+	Build   string   `json:"build,omitempty"`
+	Timeout timeouts `json:"timeout,omitzero"`
+	Opt     bool     `json:"opt,omitempty"`
+	Pinned  bool     `json:"pin,omitempty"`
+	// SkipSubmodules leaves a plugin's submodules alone, for plugins whose
+	// submodules are only needed to develop them.
+	SkipSubmodules bool `json:"skipSubmodules,omitempty"`
+}
+
+// ref returns the commit or tag that a plugin is pinned to, if any.
+func (pSpec pluginSpec) ref() string {
+	if pSpec.Commit != "" {
+		return pSpec.Commit
+	}
+
+	return pSpec.Tag
+}
+
+// frozen reports whether a plugin should never be pulled.
+func (pSpec pluginSpec) frozen() bool {
+	return pSpec.Pinned || pSpec.ref() != ""
+}
+
+const (
+	// urlPlaceholder marks where a URL template takes the shorthand.
+	urlPlaceholder     = "{}"
+	defaultURLTemplate = "https://github.com/" + urlPlaceholder
+)
+
+// shorthandURL matches URLs of the form "owner/repo".
+var shorthandURL = regexp.MustCompile(`^\w[\w.-]*/[\w.-]+$`)
+
+// expandURL expands a shorthand URL such as "owner/repo" against a template.
+// Other URLs, including local paths, are returned as they are.
+func expandURL(url, template string) string {
+	if !shorthandURL.MatchString(url) {
+		return url
+	}
+
+	return strings.ReplaceAll(template, urlPlaceholder, url)
+}
+
+// nameFromURL derives a plugin's name from the last part of its URL, dropping
+// any ".git" suffix and the first of prefixes that matches. A prefix is kept
+// if nothing else would be left.
+func nameFromURL(url string, prefixes []string) string {
+	url = strings.TrimRight(url, `/\`)
+	name := url[strings.LastIndexAny(url, `/\:`)+1:]
+	name = strings.TrimSuffix(name, ".git")
+
+	for _, prefix := range prefixes {
+		if trimmed, ok := strings.CutPrefix(name, prefix); ok && trimmed != "" {
+			return trimmed
+		}
+	}
+
+	return name
+}
+
+// checkName reports whether a plugin's name is safe to use as the name of its
+// directory in start/ or opt/.
+func checkName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("plugin has no name, and none can be derived from its url")
+	case name == "." || name == "..":
+		return fmt.Errorf("invalid plugin name %q", name)
+	case strings.ContainsAny(name, `/\`):
+		return fmt.Errorf("invalid plugin name %q: contains a path separator", name)
+	default:
+		return nil
+	}
 }
 
 // pluginState represents a plugin installed locally.
@@ -14,8 +93,40 @@ type pluginState struct {
 	name      string
 	directory string
 	url       string
-	branch    string
+	branch    string // "" if HEAD is detached
 	hash      digest
+	tagCommit digest // Commit of the pinned tag; only set if pinned to a tag
+	dirty     bool   // Uncommitted changes to tracked files
+	unpushed  bool   // Commits that no remote branch or tag contains
+
+	// Whether dirty and unpushed are known; see inspect.
+	dirtyChecked    bool
+	unpushedChecked bool
+}
+
+// localChanges describes any local modifications that pluggo could destroy,
+// or returns "" if there are none. A plugin checked out at the commit that it
+// is pinned to has no unpushed commits, even if no remote branch or tag
+// contains that commit (e.g., after upstream rewrote its history).
+func (pState *pluginState) localChanges(pSpec pluginSpec) string {
+	unpushed := pState.unpushed && !pState.atCommit(pSpec.Commit)
+
+	switch {
+	case pState.dirty && unpushed:
+		return "uncommitted changes and unpushed commits"
+	case pState.dirty:
+		return "uncommitted changes"
+	case unpushed:
+		return "unpushed commits"
+	default:
+		return ""
+	}
+}
+
+// atCommit reports whether HEAD is detached at a commit, which may be
+// abbreviated, as git itself allows.
+func (pState *pluginState) atCommit(commit string) bool {
+	return commit != "" && pState.branch == "" && strings.HasPrefix(pState.hash.String(), commit)
 }
 
 // status describes the final state of a plugin after processing.
@@ -25,9 +136,16 @@ const (
 	unknown status = iota
 	installed
 	reinstalled
+	switched
 	updated
 	removed
+	restored
+	checkedOut
+	buildFailed
+	skipped
 	unchanged
+	unmanaged
+	modified
 )
 
 // result contains the result of a plugin operation.
@@ -36,6 +154,9 @@ type result struct {
 	plugin  string
 	movedTo string // "start" or "opt"; "" if not moved
 	reason  string // Additional context (e.g., "switching branches")
+	oldHash digest
+	newHash digest
+	commits []string // One-line summaries of commits pulled in by an update
 	status  status
 	pinned  bool
 }
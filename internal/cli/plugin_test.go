@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -39,6 +40,26 @@ func TestGetPluginsSuccess(t *testing.T) {
 	}
 }
 
+func TestGetPluginsFormats(t *testing.T) {
+	t.Parallel()
+
+	for _, confFile := range []string{"testdata/plugins.jsonc", "testdata/plugins.toml"} {
+		t.Run(confFile, func(t *testing.T) {
+			t.Parallel()
+
+			cmd := fakeCmdEnv(confFile)
+			actual, err := cmd.plugins()
+			if err != nil {
+				t.Fatalf("test cannot finish since cmd.plugins() failed: %v", err)
+			}
+
+			if diff := cmp.Diff(makePlugins(), actual); diff != "" {
+				t.Errorf("cmd.plugins(%q) failure (-want +got)\n%s", confFile, diff)
+			}
+		})
+	}
+}
+
 func TestGetPluginsFailure(t *testing.T) {
 	t.Parallel()
 
@@ -50,6 +71,30 @@ func TestGetPluginsFailure(t *testing.T) {
 	}
 }
 
+func TestGetPluginsDuplicateTOMLKey(t *testing.T) {
+	t.Parallel()
+
+	cmd := fakeCmdEnv("testdata/duplicate-key.toml")
+	_, err := cmd.plugins()
+
+	expected := `line 5, column 1: invalid TOML: duplicate key "url"`
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("cmd.plugins() error = %v; want error containing %q", err, expected)
+	}
+}
+
+func TestGetPluginsCommitAndTag(t *testing.T) {
+	t.Parallel()
+
+	cmd := fakeCmdEnv("testdata/commit-and-tag.json")
+	_, err := cmd.plugins()
+
+	expected := `plugin "plugin" has both a commit and a tag`
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("cmd.plugins() error = %v; want error containing %q", err, expected)
+	}
+}
+
 func TestPluginChecks(t *testing.T) {
 	t.Parallel()
 
@@ -61,10 +106,17 @@ func TestPluginChecks(t *testing.T) {
 		t.Fatalf("test cannot finish since cmd.plugins() failed: %v", err)
 	}
 
-	// Only the last plugin should be valid (has all required fields).
-	// The first has no name, second has no URL, third has no branch.
-	if len(plugins) != 1 {
-		t.Errorf("cmd.plugins(%q) expected len(plugins) = 1; actual: %d", confFile, len(plugins))
+	// Only the second plugin, which has no URL, and the last, whose name
+	// escapes the plugin directories, are invalid. The first takes its name
+	// from its URL, and the third follows the remote's default branch.
+	expected := []string{"plugin", "plugin.git", "plugin.git"}
+	actual := make([]string, 0, len(plugins))
+	for _, pSpec := range plugins {
+		actual = append(actual, pSpec.Name)
+	}
+
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("cmd.plugins(%q) names failure (-want +got)\n%s", confFile, diff)
 	}
 }
 
@@ -78,3 +130,116 @@ func TestMissingDataDirError(t *testing.T) {
 		t.Error("expected error for missing dataDir")
 	}
 }
+
+func TestGetPluginsShorthand(t *testing.T) {
+	t.Parallel()
+
+	expected := []pluginSpec{
+		{URL: "https://git.example.com/dcampos/nvim-snippy.git", Name: "snippy"},
+		{URL: "https://github.com/dstein64/vim-startuptime", Name: "startuptime", Opt: true},
+		{URL: "git@example.com:me/fzf.vim.git", Name: "fzf.vim"},
+		{URL: "https://git.example.com/tpope/vim-fugitive.git", Name: "fugitive-custom"},
+	}
+	confFile := "testdata/shorthand.json"
+	cmd := fakeCmdEnv(confFile)
+
+	actual, err := cmd.plugins()
+	if err != nil {
+		t.Fatalf("test cannot finish since cmd.plugins() failed: %v", err)
+	}
+
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Errorf("cmd.plugins(%q) failure (-want +got)\n%s", confFile, diff)
+	}
+}
+
+func TestExpandURL(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		url      string
+		expected string
+	}{
+		"shorthand":      {url: "owner/repo", expected: "https://github.com/owner/repo"},
+		"shorthand dots": {url: "owner/repo.nvim", expected: "https://github.com/owner/repo.nvim"},
+		"https":          {url: "https://example.com/owner/repo", expected: "https://example.com/owner/repo"},
+		"scp":            {url: "git@example.com:owner/repo", expected: "git@example.com:owner/repo"},
+		"absolute path":  {url: "/src/repo", expected: "/src/repo"},
+		"relative path":  {url: "./repo", expected: "./repo"},
+		"parent path":    {url: "../owner/repo", expected: "../owner/repo"},
+		"nested path":    {url: "a/b/c", expected: "a/b/c"},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := expandURL(tc.url, defaultURLTemplate); actual != tc.expected {
+				t.Errorf("expandURL(%q) = %q; want %q", tc.url, actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestNameFromURL(t *testing.T) {
+	t.Parallel()
+
+	prefixes := []string{"vim-", "nvim-"}
+	tests := map[string]struct {
+		url      string
+		expected string
+	}{
+		"plain":          {url: "https://example.com/owner/repo", expected: "repo"},
+		"git suffix":     {url: "https://example.com/owner/repo.git", expected: "repo"},
+		"trailing slash": {url: "https://example.com/owner/repo/", expected: "repo"},
+		"vim prefix":     {url: "https://example.com/owner/vim-repo", expected: "repo"},
+		"nvim prefix":    {url: "https://example.com/owner/nvim-repo.git", expected: "repo"},
+		"only prefix":    {url: "https://example.com/owner/vim-", expected: "vim-"},
+		"scp":            {url: "git@example.com:repo.git", expected: "repo"},
+		"windows path":   {url: `C:\src\repo`, expected: "repo"},
+		"empty":          {url: "", expected: ""},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := nameFromURL(tc.url, prefixes); actual != tc.expected {
+				t.Errorf("nameFromURL(%q) = %q; want %q", tc.url, actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestLocalChanges(t *testing.T) {
+	t.Parallel()
+
+	hash := digest("130e0427badfab6b587567d6bad3c06d44a373a5")
+
+	tests := map[string]struct {
+		pState   *pluginState
+		expected string
+		pSpec    pluginSpec
+	}{
+		"clean":              {pState: &pluginState{branch: "main", hash: hash}},
+		"dirty":              {pState: &pluginState{branch: "main", hash: hash, dirty: true}, expected: "uncommitted changes"},
+		"unpushed":           {pState: &pluginState{branch: "main", hash: hash, unpushed: true}, expected: "unpushed commits"},
+		"at pinned commit":   {pState: &pluginState{hash: hash, unpushed: true}, pSpec: pluginSpec{Commit: "130e042"}},
+		"past pinned commit": {pState: &pluginState{hash: hash, unpushed: true}, pSpec: pluginSpec{Commit: "2e32312"}, expected: "unpushed commits"},
+		"dirty at pinned commit": {
+			pState:   &pluginState{hash: hash, dirty: true, unpushed: true},
+			pSpec:    pluginSpec{Commit: "130e042"},
+			expected: "uncommitted changes",
+		},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := tc.pState.localChanges(tc.pSpec); actual != tc.expected {
+				t.Errorf("pState.localChanges(%+v) = %q; want %q", tc.pSpec, actual, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package cli
+
+import (
+	"context"
+	"os/exec"
+	"time"
+)
+
+// waitDelay is how long to wait for a command's output to close after its
+// context is done. Processes that the command started, such as
+// git-remote-https or ssh, may hold the output open after it is killed.
+const waitDelay = 2 * time.Second
+
+// newCommand returns a command that is killed, along with any processes that
+// it started, when ctx is done.
+func newCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.WaitDelay = waitDelay
+	killProcessGroup(cmd)
+
+	return cmd
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package cli
+
+import "os/exec"
+
+// killProcessGroup does nothing on systems without process groups. Cancelling
+// cmd kills only cmd, and waitDelay limits how long Wait waits for the rest.
+func killProcessGroup(*exec.Cmd) {}
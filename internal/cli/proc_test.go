@@ -0,0 +1,31 @@
+//go:build unix
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNewCommandKillsChildren(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+
+	// The shell runs sleep in a child that holds stdout open.
+	var stdout bytes.Buffer
+	cmd := newCommand(ctx, "sh", "-c", "sleep 10; true")
+	cmd.Stdout = &stdout
+
+	start := time.Now()
+	if err := cmd.Run(); err == nil {
+		t.Fatal("cmd.Run() succeeded; want an error")
+	}
+
+	if elapsed := time.Since(start); elapsed >= waitDelay {
+		t.Errorf("cmd.Run() returned after %s; want less than %s", elapsed, waitDelay)
+	}
+}
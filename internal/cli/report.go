@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// jsonResult is the machine-readable form of a result.
+type jsonResult struct {
+	Plugin     string   `json:"plugin"`
+	Status     string   `json:"status"`
+	MovedTo    string   `json:"movedTo,omitempty"`
+	Reason     string   `json:"reason,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	ErrorClass string   `json:"errorClass,omitempty"`
+	Hint       string   `json:"hint,omitempty"`
+	OldCommit  string   `json:"oldCommit,omitempty"`
+	NewCommit  string   `json:"newCommit,omitempty"`
+	Commits    []string `json:"commits,omitempty"`
+	Pinned     bool     `json:"pinned"`
+}
+
+// jsonAction is the machine-readable form of a planned action.
+type jsonAction struct {
+	Plugin  string `json:"plugin"`
+	Action  string `json:"action"`
+	MovedTo string `json:"moveTo,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Commit  string `json:"commit,omitempty"`
+}
+
+// writeJSONResults writes a JSON document that describes every result.
+func writeJSONResults(w io.Writer, command string, results []result) error {
+	doc := struct {
+		Command string       `json:"command"`
+		Results []jsonResult `json:"results"`
+	}{
+		Command: command,
+		Results: make([]jsonResult, 0, len(results)),
+	}
+
+	for _, res := range results {
+		jr := jsonResult{
+			Plugin:    res.plugin,
+			Status:    statusName(res),
+			MovedTo:   res.movedTo,
+			Reason:    res.reason,
+			OldCommit: res.oldHash.String(),
+			NewCommit: res.newHash.String(),
+			Commits:   res.commits,
+			Pinned:    res.pinned,
+		}
+		if res.err != nil {
+			jr.Error = res.err.Error()
+		}
+		if class := classOf(res.err); class != nil {
+			jr.ErrorClass = class.name
+			jr.Hint = class.hint
+		}
+
+		doc.Results = append(doc.Results, jr)
+	}
+
+	return writeJSON(w, doc)
+}
+
+// writeJSONPlan writes a JSON document that describes every planned action.
+func writeJSONPlan(w io.Writer, command string, p plan) error {
+	doc := struct {
+		Command string       `json:"command"`
+		Actions []jsonAction `json:"actions"`
+	}{
+		Command: command,
+		Actions: make([]jsonAction, 0, len(p.removals)+len(p.actions)),
+	}
+
+	for _, act := range slices.Concat(p.removals, p.actions) {
+		doc.Actions = append(doc.Actions, jsonAction{
+			Plugin:  act.plugin,
+			Action:  actionName(act.kind),
+			MovedTo: act.moveTo,
+			Reason:  act.reason,
+			Commit:  act.commit.String(),
+		})
+	}
+
+	return writeJSON(w, doc)
+}
+
+func writeJSON(w io.Writer, doc any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("cannot write JSON report: %w", err)
+	}
+
+	return nil
+}
+
+// statusName returns the name of a result's status for machine consumption.
+func statusName(res result) string {
+	if res.err != nil && res.status != buildFailed {
+		return "failed"
+	}
+
+	switch res.status {
+	case installed:
+		return "installed"
+	case reinstalled:
+		return "reinstalled"
+	case switched:
+		return "switched"
+	case updated:
+		return "updated"
+	case removed:
+		return "removed"
+	case restored:
+		return "restored"
+	case checkedOut:
+		return "checked-out"
+	case buildFailed:
+		return "build-failed"
+	case skipped:
+		return "skipped"
+	case unchanged:
+		return "unchanged"
+	case unmanaged:
+		return "unmanaged"
+	case modified:
+		return "locally-modified"
+	default:
+		return "unknown"
+	}
+}
+
+// actionName returns the name of a planned action for machine consumption.
+func actionName(kind actionKind) string {
+	switch kind {
+	case installAction:
+		return "install"
+	case switchAction:
+		return "switch"
+	case updateAction:
+		return "update"
+	case checkoutAction:
+		return "checkout"
+	case removeAction:
+		return "remove"
+	case skipAction:
+		return "skip"
+	case keepAction:
+		return "keep"
+	case modifiedAction:
+		return "locally-modified"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestWriteJSONResults(t *testing.T) {
+	t.Parallel()
+
+	results := []result{
+		{
+			plugin:  "foo",
+			status:  updated,
+			oldHash: digest("e55e51201fb7231bc219aecb0e9d969641cb73d0"),
+			newHash: digest("29d0a18059af15e03aae5dcf98a5f6d146c2ad1f"),
+			commits: []string{"29d0a18 change 2"},
+		},
+		{
+			plugin: "bar",
+			err:    errors.New("git clone failed: exit status 128"),
+		},
+	}
+
+	expected := `{
+    "command": "sync",
+    "results": [
+        {
+            "plugin": "foo",
+            "status": "updated",
+            "oldCommit": "e55e51201fb7231bc219aecb0e9d969641cb73d0",
+            "newCommit": "29d0a18059af15e03aae5dcf98a5f6d146c2ad1f",
+            "commits": [
+                "29d0a18 change 2"
+            ],
+            "pinned": false
+        },
+        {
+            "plugin": "bar",
+            "status": "failed",
+            "error": "git clone failed: exit status 128",
+            "pinned": false
+        }
+    ]
+}
+`
+
+	var buf bytes.Buffer
+	if err := writeJSONResults(&buf, "sync", results); err != nil {
+		t.Fatalf("writeJSONResults() failed: %v", err)
+	}
+
+	if actual := buf.String(); actual != expected {
+		t.Errorf("writeJSONResults() = %s; want %s", actual, expected)
+	}
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	defaultAttempts = 3
+	retryBackoff    = time.Second
+)
+
+// isTransient reports whether err is a git failure that may succeed if tried
+// again, such as a dropped connection, a server error, or a timeout.
+func isTransient(err error) bool {
+	return errors.Is(err, errNetwork) || errors.Is(err, errTimeout)
+}
+
+// retry runs op until it succeeds, fails permanently, or runs out of attempts.
+// Each attempt may run for timeout, and the wait between attempts doubles
+// after each transient failure.
+func (cmd *cmdEnv) retry(ctx context.Context, pluginName string, timeout duration, op func(context.Context) error) error {
+	delay := cmd.backoff
+
+	for attempt := 1; ; attempt++ {
+		err := cmd.attempt(ctx, timeout, op)
+		if err == nil || attempt >= cmd.attempts || !isTransient(err) {
+			return err
+		}
+
+		cmd.debugf("%s: %q failed (attempt %d of %d), retrying in %s: %s",
+			cmd.name, pluginName, attempt, cmd.attempts, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (cmd *cmdEnv) attempt(ctx context.Context, timeout duration, op func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout))
+	defer cancel()
+
+	return op(ctx)
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIsTransient(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"connection reset": {
+			err:      &gitError{stderr: "error: RPC failed; curl 56 Recv failure: Connection reset by peer"},
+			expected: true,
+		},
+		"server error": {
+			err:      &gitError{stderr: "fatal: unable to access 'https://example.com/foo/': The requested URL returned error: 502"},
+			expected: true,
+		},
+		"dns failure": {
+			err:      &gitError{stderr: "fatal: unable to access 'https://example.com/foo/': Could not resolve host: example.com"},
+			expected: true,
+		},
+		"timeout": {
+			err:      &gitError{op: "git fetch", err: errors.New("signal: killed"), timedOut: true},
+			expected: true,
+		},
+		"missing branch": {
+			err: &gitError{stderr: "warning: Could not find remote branch nope to clone.\nfatal: Remote branch nope not found in upstream origin"},
+		},
+		"auth failure": {
+			err: &gitError{stderr: "remote: Invalid username or password.\nfatal: Authentication failed for 'https://example.com/foo/'"},
+		},
+		"ssh auth failure": {
+			err: &gitError{stderr: "git@example.com: Permission denied (publickey).\nfatal: Could not read from remote repository."},
+		},
+		"client error": {
+			err: &gitError{stderr: "fatal: unable to access 'https://example.com/foo/': The requested URL returned error: 403"},
+		},
+		"not a git error": {
+			err: errors.New("connection reset"),
+		},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := isTransient(tc.err); actual != tc.expected {
+				t.Errorf("isTransient(%v) = %t; want %t", tc.err, actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+
+	transient := &gitError{op: "git pull", err: errors.New("exit status 1"), stderr: "fatal: early EOF"}
+	permanent := &gitError{op: "git pull", err: errors.New("exit status 1"), stderr: "fatal: repository not found"}
+	timeout := &gitError{op: "git pull", err: errors.New("signal: killed"), timedOut: true}
+
+	tests := map[string]struct {
+		errs          []error // Errors for successive attempts; nil after they run out
+		expectedCalls int
+		expectErr     bool
+	}{
+		"success":              {expectedCalls: 1},
+		"transient then ok":    {errs: []error{transient, transient}, expectedCalls: 3},
+		"transient every time": {errs: []error{transient, transient, transient, transient}, expectedCalls: 3, expectErr: true},
+		"permanent":            {errs: []error{permanent, transient}, expectedCalls: 1, expectErr: true},
+		"timeout then ok":      {errs: []error{timeout}, expectedCalls: 2},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			cmd := &cmdEnv{name: "test", attempts: 3, backoff: time.Millisecond}
+			calls := 0
+			err := cmd.retry(t.Context(), "foo", duration(time.Minute), func(context.Context) error {
+				calls++
+				if calls <= len(tc.errs) {
+					return tc.errs[calls-1]
+				}
+
+				return nil
+			})
+
+			if calls != tc.expectedCalls {
+				t.Errorf("cmd.retry() made %d calls; want %d", calls, tc.expectedCalls)
+			}
+			if (err != nil) != tc.expectErr {
+				t.Errorf("cmd.retry() error = %v; want error: %t", err, tc.expectErr)
+			}
+		})
+	}
+}
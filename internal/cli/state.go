@@ -2,6 +2,7 @@ package cli
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"slices"
@@ -51,8 +52,11 @@ func (cmd *cmdEnv) scanPackDir(ctx context.Context, baseDir string) map[string]*
 	}
 	results := make(chan result, len(entries))
 
+	sem := make(chan struct{}, cmd.jobs)
 	for _, entry := range entries {
+		sem <- struct{}{}
 		go func() {
+			defer func() { <-sem }()
 			pluginName := entry.Name()
 			state := cmd.createState(ctx, baseDir, pluginName)
 			results <- result{name: pluginName, state: state}
@@ -73,13 +77,13 @@ func (cmd *cmdEnv) scanPackDir(ctx context.Context, baseDir string) map[string]*
 func (cmd *cmdEnv) createState(ctx context.Context, baseDir, pluginName string) *pluginState {
 	pluginDir := filepath.Join(baseDir, pluginName)
 
-	url, err := repoURL(ctx, pluginDir)
+	url, err := cmd.git.repoURL(ctx, pluginDir)
 	if err != nil {
 		cmd.warnf("%s: skipping %q: cannot determine repo URL: %s", cmd.name, pluginName, err)
 		return nil
 	}
 
-	info, err := getBranchInfo(ctx, pluginDir)
+	info, err := cmd.git.getBranchInfo(ctx, pluginDir)
 	if err != nil {
 		cmd.warnf("%s: skipping %q: cannot determine repo state: %s", cmd.name, pluginName, err)
 		return nil
@@ -93,3 +97,108 @@ func (cmd *cmdEnv) createState(ctx context.Context, baseDir, pluginName string)
 		hash:      info.hash,
 	}
 }
+
+// inspect resolves the tags of plugins pinned to a tag and checks for local
+// changes in the plugins that the command may change destructively, or in
+// every plugin if all is set. Unlike scanning and resolving tags, which read
+// git's files directly, these checks run git, so inspect leaves out plugins
+// that will at most be updated; update checks those itself once it knows that
+// upstream changed. As when scanning, inspect skips any plugin that it cannot
+// check.
+func (cmd *cmdEnv) inspect(ctx context.Context, statesByName map[string]*pluginState, pSpecs []pluginSpec, all bool) {
+	specsByName := makeSpecMap(pSpecs)
+
+	type result struct {
+		err  error
+		name string
+	}
+	results := make(chan result, len(statesByName))
+
+	sem := make(chan struct{}, cmd.jobs)
+	for pluginName, pState := range statesByName {
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem }()
+			pSpec, wanted := specsByName[pluginName]
+			results <- result{name: pluginName, err: cmd.inspectPlugin(ctx, pState, pSpec, wanted, all)}
+		}()
+	}
+
+	for range statesByName {
+		r := <-results
+		if r.err != nil {
+			cmd.warnf("%s: skipping %q: %s", cmd.name, r.name, r.err)
+			delete(statesByName, r.name)
+		}
+	}
+}
+
+func (cmd *cmdEnv) inspectPlugin(ctx context.Context, pState *pluginState, pSpec pluginSpec, wanted, all bool) error {
+	// Plugins pinned to a tag have a detached HEAD. Record the tag's commit
+	// so that we can tell whether the pin has changed.
+	if pSpec.Tag != "" && pState.branch == "" {
+		commit, err := cmd.git.tagCommit(ctx, pState.directory, pSpec.Tag)
+		if err != nil {
+			return fmt.Errorf("cannot resolve tag %q: %w", pSpec.Tag, err)
+		}
+		pState.tagCommit = commit
+	}
+
+	var destructive bool
+	switch {
+	case all:
+		destructive = true
+	case !wanted:
+		destructive = (cmd.subcmd == "sync" || cmd.subcmd == "clean") && !cmd.isKept(pState.name)
+	case cmd.subcmd == "sync" || cmd.subcmd == "update":
+		// Update skips plugins whose URL or branch changed.
+		configChanged, _ := cmd.hasConfigChanged(pState, pSpec)
+		refChanged, _ := cmd.hasRefChanged(pState, pSpec)
+		destructive = refChanged || (configChanged && cmd.subcmd == "sync")
+	}
+	if !destructive {
+		return nil
+	}
+
+	return cmd.checkLocal(ctx, pState, pSpec)
+}
+
+// checkLocal finds out whether a plugin has uncommitted changes or unpushed
+// commits, unless that is known already.
+func (cmd *cmdEnv) checkLocal(ctx context.Context, pState *pluginState, pSpec pluginSpec) error {
+	if err := cmd.checkUnpushed(ctx, pState, pSpec); err != nil {
+		return err
+	}
+
+	if pState.dirtyChecked {
+		return nil
+	}
+
+	dirty, err := cmd.git.isDirty(ctx, pState.directory)
+	if err != nil {
+		return fmt.Errorf("cannot determine repo status: %w", err)
+	}
+	pState.dirty = dirty
+	pState.dirtyChecked = true
+
+	return nil
+}
+
+// checkUnpushed finds out whether a plugin has unpushed commits, unless that
+// is known already. The answer depends on origin's branches, so it must come
+// before a fetch moves them.
+func (cmd *cmdEnv) checkUnpushed(ctx context.Context, pState *pluginState, pSpec pluginSpec) error {
+	// See localChanges for why a plugin at its pinned commit needs no check.
+	if pState.unpushedChecked || pState.atCommit(pSpec.Commit) {
+		return nil
+	}
+
+	unpushed, err := cmd.git.hasUnpushed(ctx, pState.directory)
+	if err != nil {
+		return fmt.Errorf("cannot determine repo status: %w", err)
+	}
+	pState.unpushed = unpushed
+	pState.unpushedChecked = true
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// checkCounter records which plugins a backend checks for local changes.
+type checkCounter struct {
+	gitBackend
+	checked []string
+	mu      sync.Mutex
+}
+
+func (c *checkCounter) isDirty(ctx context.Context, repoDir string) (bool, error) {
+	c.mu.Lock()
+	c.checked = append(c.checked, filepath.Base(repoDir))
+	c.mu.Unlock()
+
+	return c.gitBackend.isDirty(ctx, repoDir)
+}
+
+func TestInspect(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		subcmd   string
+		expected []string
+		all      bool
+	}{
+		"sync":   {subcmd: "sync", expected: []string{"bar", "old"}},
+		"update": {subcmd: "update", expected: nil},
+		"clean":  {subcmd: "clean", expected: []string{"old"}},
+		"status": {subcmd: "sync", all: true, expected: []string{"bar", "foo", "old"}},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			remotes := newFakeGit()
+			for _, name := range []string{"foo", "bar", "old"} {
+				remotes.commit(t, name, "main", "first "+name)
+			}
+			remotes.commit(t, "bar", "dev", "dev bar")
+
+			counter := &checkCounter{gitBackend: remotes.backend()}
+			cmd := testSyncEnv(t, counter)
+			foo := pluginSpec{Name: "foo", URL: remotes.url("foo"), Branch: "main"}
+			bar := pluginSpec{Name: "bar", URL: remotes.url("bar"), Branch: "main"}
+			old := pluginSpec{Name: "old", URL: remotes.url("old"), Branch: "main"}
+			runSync(t, cmd, []pluginSpec{foo, bar, old})
+
+			// Only bar's switch and old's removal could discard local changes.
+			cmd.subcmd = tc.subcmd
+			bar.Branch = "dev"
+			counter.checked = nil
+			cmd.inspect(t.Context(), cmd.makeStateMap(t.Context()), []pluginSpec{foo, bar}, tc.all)
+
+			slices.Sort(counter.checked)
+			if diff := cmp.Diff(tc.expected, counter.checked); diff != "" {
+				t.Errorf("cmd.inspect() checked plugins failure (-want +got)\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// status reports how the installed plugins compare with the config without
+// changing anything on disk.
+func (cmd *cmdEnv) status(ctx context.Context, pSpecs []pluginSpec, rep *reporter) {
+	rep.start(cmd.name + ": checking plugins...")
+
+	statesByName := cmd.makeStateMap(ctx)
+	cmd.inspect(ctx, statesByName, pSpecs, true)
+	unwanted := findUnwanted(statesByName, makeSpecMap(pSpecs))
+
+	rep.stop()
+
+	for _, pSpec := range pSpecs {
+		fmt.Printf("%s%s: %s\n", rep.indent, pSpec.Name, cmd.describeState(statesByName[pSpec.Name], pSpec))
+	}
+
+	for _, pluginName := range slices.Sorted(maps.Keys(unwanted)) {
+		if cmd.isKept(pluginName) {
+			fmt.Printf("%s%s: unmanaged (not in config, kept)\n", rep.indent, pluginName)
+			continue
+		}
+
+		if changes := statesByName[pluginName].localChanges(pluginSpec{}); changes != "" {
+			fmt.Printf("%s%s: not in config, locally modified (%s)\n", rep.indent, pluginName, changes)
+			continue
+		}
+
+		fmt.Printf("%s%s: not in config (clean would remove it)\n", rep.indent, pluginName)
+	}
+}
+
+// describeState summarizes what sync would need to do for a plugin.
+func (cmd *cmdEnv) describeState(pState *pluginState, pSpec pluginSpec) string {
+	if pState == nil {
+		return "not installed"
+	}
+
+	if changes := pState.localChanges(pSpec); changes != "" {
+		return "locally modified (" + changes + ")"
+	}
+
+	if changed, reason := cmd.hasConfigChanged(pState, pSpec); changed {
+		return "needs switch (" + reason + ")"
+	}
+
+	if changed, reason := cmd.hasRefChanged(pState, pSpec); changed {
+		return "needs checkout (" + reason + ")"
+	}
+
+	var msg strings.Builder
+	msg.WriteString("installed at ")
+	msg.WriteString(pState.hash.short())
+
+	if moveTo := cmd.moveTarget(pState, pSpec); moveTo != "" {
+		msg.WriteString(", needs move to " + moveTo + "/")
+	}
+
+	switch {
+	case pSpec.ref() != "":
+		msg.WriteString(", pinned to " + pSpec.ref())
+	case pSpec.Pinned:
+		msg.WriteString(", pinned")
+	}
+
+	return msg.String()
+}
+
+// list prints the plugins in the config.
+func (cmd *cmdEnv) list(pSpecs []pluginSpec) {
+	for _, pSpec := range pSpecs {
+		dir := "start"
+		if pSpec.Opt {
+			dir = "opt"
+		}
+
+		var msg strings.Builder
+		msg.WriteString(pSpec.Name)
+		msg.WriteString(" (")
+		msg.WriteString(dir)
+		switch {
+		case pSpec.Commit != "":
+			msg.WriteString(", commit " + pSpec.Commit)
+		case pSpec.Tag != "":
+			msg.WriteString(", tag " + pSpec.Tag)
+		case pSpec.Branch == "":
+			msg.WriteString(", default branch")
+		default:
+			msg.WriteString(", " + pSpec.Branch)
+		}
+		if pSpec.Pinned {
+			msg.WriteString(", pinned")
+		}
+		msg.WriteString("): ")
+		msg.WriteString(pSpec.URL)
+
+		fmt.Println(msg.String())
+	}
+}
@@ -2,33 +2,50 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path"
 )
 
-// sync brings the local plugin state into agreement with the config file.
-func (cmd *cmdEnv) sync(ctx context.Context, pSpecs []pluginSpec, rep *reporter) error {
-	if err := cmd.ensurePluginDirs(); err != nil {
-		return err
+// prepare creates the plugin directories, loads the lockfile, and returns the installed plugins by name, inspected for the command. In
+// dry-run mode, prepare creates nothing.
+func (cmd *cmdEnv) prepare(ctx context.Context, rep *reporter, pSpecs []pluginSpec) (map[string]*pluginState, error) {
+	if !cmd.dryRunWanted {
+		if err := cmd.ensurePluginDirs(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Outside restore mode, writeLock only needs the lockfile's old entries
+	// for plugins that this run leaves alone.
+	locked, err := cmd.readLock()
+	switch {
+	case err == nil:
+		cmd.locked = locked
+	case cmd.restoreWanted:
+		return nil, err
+	default:
+		cmd.debugf("%s: %s", cmd.name, err)
 	}
 
 	rep.start(cmd.name + ": processing plugins...")
 
 	statesByName := cmd.makeStateMap(ctx)
-	specsByName := makeSpecMap(pSpecs)
-
-	unwanted := findUnwanted(statesByName, specsByName)
-	cmd.results = make([]result, 0, len(pSpecs)+len(unwanted))
-
-	cmd.removeAll(unwanted)
-	cmd.reconcileLocal(ctx, statesByName, pSpecs)
+	cmd.inspect(ctx, statesByName, pSpecs, false)
 
-	return nil
+	return statesByName, nil
 }
 
-// ensurePluginDirs creates the start/ and opt/ directories if needed.
+// ensurePluginDirs creates the start/, opt/, and staging directories if needed.
+// Anything left in the staging directory comes from an interrupted run, so
+// ensurePluginDirs removes it first.
 func (cmd *cmdEnv) ensurePluginDirs() error {
-	for _, wantedDir := range []string{cmd.startDir, cmd.optDir} {
+	if err := os.RemoveAll(cmd.stagingDir); err != nil {
+		return fmt.Errorf("cannot remove directory %q: %w", cmd.stagingDir, err)
+	}
+
+	for _, wantedDir := range []string{cmd.startDir, cmd.optDir, cmd.stagingDir} {
 		if err := os.MkdirAll(wantedDir, 0o755); err != nil {
 			return fmt.Errorf("cannot create directory %q: %w", wantedDir, err)
 		}
@@ -59,146 +76,376 @@ func findUnwanted(statesByName map[string]*pluginState, specsByName map[string]p
 	return unwanted
 }
 
+// isKept reports whether a plugin matches a name or pattern in the keep list.
+func (cmd *cmdEnv) isKept(pluginName string) bool {
+	for _, pattern := range cmd.keep {
+		// Patterns are checked when the config is loaded.
+		if ok, _ := path.Match(pattern, pluginName); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// execute carries out a plan: first removals, then all other actions.
+func (cmd *cmdEnv) execute(ctx context.Context, p plan) {
+	cmd.results = make([]result, 0, len(p.removals)+len(p.actions))
+
+	cmd.removeAll(p.removals)
+	cmd.reconcileLocal(ctx, p.actions)
+}
+
 // removeAll removes unwanted plugins.
-func (cmd *cmdEnv) removeAll(unwanted map[string]string) {
-	for pluginName, pluginPath := range unwanted {
-		if err := os.RemoveAll(pluginPath); err != nil {
-			cmd.warnf("%s: skipping %q: failed to remove plugin: %s", cmd.name, pluginName, err)
+func (cmd *cmdEnv) removeAll(removals []action) {
+	for _, act := range removals {
+		if err := cmd.checkPluginPath(act.pState.directory); err != nil {
+			cmd.warnf("%s: skipping %q: %s", cmd.name, act.plugin, err)
+			continue
+		}
+
+		if err := os.RemoveAll(act.pState.directory); err != nil {
+			cmd.warnf("%s: skipping %q: failed to remove plugin: %s", cmd.name, act.plugin, err)
 			continue
 		}
 
 		cmd.results = append(cmd.results, result{
-			plugin: pluginName,
-			status: removed,
+			plugin:  act.plugin,
+			status:  removed,
+			oldHash: act.pState.hash,
 		})
 	}
 }
 
-// reconcileLocal processes all plugins in parallel using goroutines.
-func (cmd *cmdEnv) reconcileLocal(ctx context.Context, statesByName map[string]*pluginState, pSpecs []pluginSpec) {
-	const maxWorkers = 15
-	sem := make(chan struct{}, maxWorkers)
-	ch := make(chan result, len(pSpecs))
+// reconcileLocal processes all plugins in parallel using goroutines, running at
+// most cmd.jobs at a time.
+func (cmd *cmdEnv) reconcileLocal(ctx context.Context, actions []action) {
+	sem := make(chan struct{}, cmd.jobs)
+	ch := make(chan result, len(actions))
 
-	for _, spec := range pSpecs {
+	for _, act := range actions {
 		sem <- struct{}{}
 		go func() {
 			defer func() { <-sem }()
-			cmd.reconcile(ctx, statesByName[spec.Name], spec, ch)
+			cmd.reconcile(ctx, act, ch)
 		}()
 	}
 
-	for range pSpecs {
+	for range actions {
 		res := <-ch
 		cmd.results = append(cmd.results, res)
 	}
 }
 
-// reconcile determines what action to take for a single plugin.
-// This is the main decision tree: if not installed, install; if config changed, reinstall; otherwise move (if needed) and update (unless pinned).
-func (cmd *cmdEnv) reconcile(ctx context.Context, pState *pluginState, pSpec pluginSpec, ch chan<- result) {
-	// Plugin not installed locally: clone it.
-	if pState == nil {
-		cmd.manageClone(ctx, pSpec, ch)
-		return
+// reconcile carries out a single planned action.
+func (cmd *cmdEnv) reconcile(ctx context.Context, act action, ch chan<- result) {
+	switch act.kind {
+	case installAction:
+		cmd.manageClone(ctx, act, ch)
+	case switchAction:
+		cmd.manageSwitch(ctx, act, ch)
+	case updateAction:
+		cmd.manageMoveAndUpdate(ctx, act, ch)
+	case checkoutAction:
+		cmd.manageMoveAndCheckout(ctx, act, ch)
+	case skipAction:
+		res := result{
+			plugin: act.plugin,
+			status: skipped,
+			reason: act.reason,
+		}
+		if act.pState != nil {
+			res.oldHash = act.pState.hash
+			res.newHash = act.pState.hash
+		}
+		ch <- res
+	case keepAction:
+		ch <- result{
+			plugin:  act.plugin,
+			status:  unmanaged,
+			oldHash: act.pState.hash,
+			newHash: act.pState.hash,
+		}
+	case modifiedAction:
+		ch <- result{
+			plugin:  act.plugin,
+			status:  modified,
+			reason:  act.reason,
+			oldHash: act.pState.hash,
+			newHash: act.pState.hash,
+		}
+	default:
+		panic(fmt.Sprintf("unreachable: invalid action %d", act.kind))
 	}
+}
+
+func (cmd *cmdEnv) manageClone(ctx context.Context, act action, ch chan<- result) {
+	pSpec := act.pSpec
+	res := result{plugin: pSpec.Name}
+
+	if err := cmd.install(ctx, pSpec, act.commit); err != nil {
+		cmd.warnf("%s: clone %q failed: %s", cmd.name, pSpec.Name, err)
+		res.err = err
+		ch <- res
 
-	// URL or branch have changed: reinstall.
-	if changed, reason := cmd.hasConfigChanged(pState, pSpec); changed {
-		cmd.manageReinstall(ctx, pState, pSpec, reason, ch)
 		return
 	}
 
-	// URL and branch unchanged: move if needed, then update if not pinned.
-	cmd.manageMoveAndUpdate(ctx, pState, pSpec, ch)
+	res.status = installed
+	res.newHash = cmd.headHash(ctx, cmd.pluginPath(pSpec), pSpec)
+	cmd.manageChanged(ctx, cmd.pluginPath(pSpec), pSpec, &res)
+
+	ch <- res
 }
 
-func (cmd *cmdEnv) manageClone(ctx context.Context, pSpec pluginSpec, ch chan<- result) {
-	if err := clone(ctx, pSpec.URL, pSpec.Branch, cmd.pluginPath(pSpec)); err != nil {
-		cmd.warnf("%s: clone %q failed: %s", cmd.name, pSpec.Name, err)
-		ch <- result{
-			plugin: pSpec.Name,
-			err:    err,
-		}
+func (cmd *cmdEnv) manageSwitch(ctx context.Context, act action, ch chan<- result) {
+	pState, pSpec := act.pState, act.pSpec
+	res := result{
+		plugin:  pSpec.Name,
+		oldHash: pState.hash,
+	}
+
+	movedTo, err := cmd.move(pState, pSpec)
+	if err != nil {
+		cmd.warnf("%s: move %q failed: %s", cmd.name, pSpec.Name, err)
+		res.err = err
+		ch <- res
 
 		return
 	}
 
-	ch <- result{
-		plugin: pSpec.Name,
-		status: installed,
+	inPlace, err := cmd.switchInPlace(ctx, pState, pSpec, act.commit)
+	if err == nil && !inPlace {
+		// The new URL is a different repository, so clone it instead.
+		err = cmd.reinstall(ctx, pState.directory, pSpec, act.commit)
 	}
-}
-
-func (cmd *cmdEnv) manageReinstall(ctx context.Context, pState *pluginState, pSpec pluginSpec, reason string, ch chan<- result) {
-	if err := cmd.reinstall(ctx, pState.directory, pSpec); err != nil {
-		cmd.warnf("%s: reinstall %q failed: %s", cmd.name, pSpec.Name, err)
-		ch <- result{
-			plugin: pSpec.Name,
-			err:    err,
-		}
+	if err != nil {
+		cmd.warnf("%s: switch %q failed: %s", cmd.name, pSpec.Name, err)
+		res.err = err
+		ch <- res
 
 		return
 	}
 
-	ch <- result{
-		plugin: pSpec.Name,
-		status: reinstalled,
-		reason: reason,
+	if inPlace {
+		res.status = switched
+		res.reason = act.reason
+		res.movedTo = movedTo
+	} else {
+		res.status = reinstalled
+		res.reason = act.reason + "; no history in common"
 	}
+	res.newHash = cmd.headHash(ctx, cmd.pluginPath(pSpec), pSpec)
+	cmd.manageChanged(ctx, cmd.pluginPath(pSpec), pSpec, &res)
+
+	ch <- res
 }
 
-func (cmd *cmdEnv) manageMoveAndUpdate(ctx context.Context, pState *pluginState, pSpec pluginSpec, ch chan<- result) {
+func (cmd *cmdEnv) manageMoveAndUpdate(ctx context.Context, act action, ch chan<- result) {
+	pState, pSpec := act.pState, act.pSpec
 	res := result{
 		plugin: pSpec.Name,
 		// Default status is unchanged.
-		status: unchanged,
+		status:  unchanged,
+		oldHash: pState.hash,
+		newHash: pState.hash,
 	}
 
-	// First, move the plugin if requested.
-	movedTo, err := cmd.move(pState, pSpec)
-	if err != nil {
-		cmd.warnf("%s: move %q failed: %s", cmd.name, pSpec.Name, err)
-		res.err = err
+	if !cmd.manageMove(act, &res) {
 		ch <- res
 
 		return
 	}
 
-	if movedTo != "" {
-		res.movedTo = movedTo
+	switch {
+	case act.commit != nil:
+		// In restore mode, move the plugin to its locked commit instead of
+		// pulling.
+		cmd.manageRestore(ctx, act, &res)
+	case pSpec.frozen():
+		res.pinned = true
+	default:
+		cmd.manageUpdate(ctx, pState, pSpec, &res)
 	}
 
-	// Next, update the plugin if not pinned.
-	if pSpec.Pinned {
-		res.pinned = true
+	ch <- res
+}
+
+func (cmd *cmdEnv) manageMoveAndCheckout(ctx context.Context, act action, ch chan<- result) {
+	pState, pSpec := act.pState, act.pSpec
+	res := result{
+		plugin:  pSpec.Name,
+		status:  checkedOut,
+		reason:  act.reason,
+		oldHash: pState.hash,
+		pinned:  true,
+	}
+
+	if !cmd.manageMove(act, &res) {
 		ch <- res
 
 		return
 	}
 
-	oldHash := pState.hash
-	if updateErr := cmd.update(ctx, pState); updateErr != nil {
-		cmd.warnf("%s: update %q failed: %s", cmd.name, pSpec.Name, updateErr)
-		res.err = updateErr
+	if err := cmd.checkout(ctx, pState.directory, pSpec); err != nil {
+		cmd.warnf("%s: checkout %q failed: %s", cmd.name, pSpec.Name, err)
+		res.err = err
 		ch <- res
 
 		return
 	}
 
+	res.newHash = cmd.headHash(ctx, pState.directory, pSpec)
+	cmd.manageChanged(ctx, pState.directory, pSpec, &res)
+
+	ch <- res
+}
+
+// manageMove moves a plugin between start and opt if the plan says to. It
+// reports whether the plugin is now in the right place. If the move fails,
+// manageMove marks res accordingly.
+func (cmd *cmdEnv) manageMove(act action, res *result) bool {
+	if act.moveTo == "" {
+		return true
+	}
+
+	movedTo, err := cmd.move(act.pState, act.pSpec)
+	if err != nil {
+		cmd.warnf("%s: move %q failed: %s", cmd.name, act.pSpec.Name, err)
+		res.err = err
+
+		return false
+	}
+	res.movedTo = movedTo
+
+	return true
+}
+
+// manageRestore moves a plugin to its locked commit and marks res with the
+// outcome.
+func (cmd *cmdEnv) manageRestore(ctx context.Context, act action, res *result) {
+	pState, pSpec, commit := act.pState, act.pSpec, act.commit
+
+	var err error
+	if pState.hash.equals(commit) {
+		// As in update, submodules may be missing even at the right commit.
+		err = cmd.updateSubmodules(ctx, pState.directory, pSpec)
+	} else if err = cmd.keepChanges(ctx, pState, pSpec); err == nil {
+		err = cmd.restore(ctx, pState.directory, pSpec, commit)
+	}
+	if cmd.leftAlone(err, res) {
+		return
+	}
+	if err != nil {
+		cmd.warnf("%s: restore %q failed: %s", cmd.name, pSpec.Name, err)
+		res.err = err
+
+		return
+	}
+
+	res.newHash = commit
+	if !pState.hash.equals(commit) {
+		res.status = restored
+		cmd.manageChanged(ctx, pState.directory, pSpec, res)
+	}
+}
+
+// manageUpdate pulls a plugin's new commits and marks res with the outcome.
+func (cmd *cmdEnv) manageUpdate(ctx context.Context, pState *pluginState, pSpec pluginSpec, res *result) {
+	note, err := cmd.update(ctx, pState, pSpec)
+	if cmd.leftAlone(err, res) {
+		return
+	}
+	if err != nil {
+		cmd.warnf("%s: update %q failed: %s", cmd.name, pSpec.Name, err)
+		res.err = err
+
+		return
+	}
+
 	// Determine whether the plugin was actually updated.
-	info, err := getBranchInfo(ctx, pState.directory)
+	info, err := cmd.git.getBranchInfo(ctx, pState.directory)
 	if err != nil {
 		cmd.warnf("%s: cannot determine new hash for %q: %s", cmd.name, pSpec.Name, err)
 		res.err = err
-		ch <- res
 
 		return
 	}
 
-	if !oldHash.equals(info.hash) {
-		res.status = updated
+	res.newHash = info.hash
+	if res.oldHash.equals(info.hash) && note == "" {
+		return
 	}
 
-	ch <- res
+	res.status = updated
+	// After a rewrite or a change of branch, the new commits are not simply
+	// the ones that were added.
+	if note != "" {
+		res.reason = note
+	} else {
+		cmd.manageCommits(ctx, pState.directory, pSpec, res)
+	}
+	cmd.manageChanged(ctx, pState.directory, pSpec, res)
+}
+
+// leftAlone reports whether err means that a plugin was left alone to keep its
+// local changes and, if so, marks res accordingly.
+func (cmd *cmdEnv) leftAlone(err error, res *result) bool {
+	var changesErr *localChangesError
+	if !errors.As(err, &changesErr) {
+		return false
+	}
+
+	res.status = modified
+	res.reason = changesErr.changes
+
+	return true
+}
+
+// headHash returns the commit that a plugin has checked out, or nil if it
+// cannot be determined.
+func (cmd *cmdEnv) headHash(ctx context.Context, dir string, pSpec pluginSpec) digest {
+	info, err := cmd.git.getBranchInfo(ctx, dir)
+	if err != nil {
+		cmd.warnf("%s: cannot determine new hash for %q: %s", cmd.name, pSpec.Name, err)
+		return nil
+	}
+
+	return info.hash
+}
+
+// manageCommits records the commits that an update pulled in.
+func (cmd *cmdEnv) manageCommits(ctx context.Context, dir string, pSpec pluginSpec, res *result) {
+	commits, err := cmd.git.commitsBetween(ctx, dir, res.oldHash, res.newHash)
+	if err != nil {
+		cmd.warnf("%s: cannot list new commits for %q: %s", cmd.name, pSpec.Name, err)
+		return
+	}
+
+	res.commits = commits
+}
+
+// manageChanged runs a plugin's build command, if any, and regenerates its
+// help tags after the plugin's code changed.
+func (cmd *cmdEnv) manageChanged(ctx context.Context, dir string, pSpec pluginSpec, res *result) {
+	cmd.manageBuild(ctx, dir, pSpec, res)
+
+	// Missing help tags are not worth failing a plugin over.
+	if err := helptags(dir); err != nil {
+		cmd.warnf("%s: cannot generate help tags for %q: %s", cmd.name, pSpec.Name, err)
+	}
+}
+
+// manageBuild runs a plugin's build command, if any. If the build fails,
+// manageBuild marks res accordingly.
+func (cmd *cmdEnv) manageBuild(ctx context.Context, dir string, pSpec pluginSpec, res *result) {
+	if pSpec.Build == "" {
+		return
+	}
+
+	if err := runBuild(ctx, dir, pSpec.Build, cmd.timeoutsFor(pSpec).Build); err != nil {
+		cmd.warnf("%s: build %q failed: %s", cmd.name, pSpec.Name, err)
+		res.err = err
+		res.status = buildFailed
+	}
 }
@@ -0,0 +1,377 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// resultSummary is the part of a result that tests compare.
+type resultSummary struct {
+	Plugin  string
+	Status  string
+	Reason  string
+	MovedTo string
+	Commits int
+}
+
+func testSyncEnv(t *testing.T, backend gitBackend) *cmdEnv {
+	t.Helper()
+
+	cmd := &cmdEnv{
+		name:        "test",
+		subcmd:      "sync",
+		git:         backend,
+		jobs:        defaultJobs,
+		quietWanted: true,
+	}
+	if err := cmd.setupDirs([]string{t.TempDir(), "pack"}); err != nil {
+		t.Fatal(err)
+	}
+
+	return cmd
+}
+
+// runSync plans and executes a sync, as process does, and summarizes the
+// results in order by plugin.
+func runSync(t *testing.T, cmd *cmdEnv, pSpecs []pluginSpec) []resultSummary {
+	t.Helper()
+
+	ctx := t.Context()
+	if err := cmd.ensurePluginDirs(); err != nil {
+		t.Fatal(err)
+	}
+	statesByName := cmd.makeStateMap(ctx)
+	cmd.inspect(ctx, statesByName, pSpecs, false)
+	cmd.execute(ctx, cmd.makePlan(statesByName, pSpecs))
+
+	summaries := make([]resultSummary, 0, len(cmd.results))
+	for _, res := range cmd.results {
+		summaries = append(summaries, resultSummary{
+			Plugin:  res.plugin,
+			Status:  statusName(res),
+			Reason:  res.reason,
+			MovedTo: res.movedTo,
+			Commits: len(res.commits),
+		})
+	}
+	slices.SortFunc(summaries, func(a, b resultSummary) int {
+		return strings.Compare(a.Plugin, b.Plugin)
+	})
+
+	return summaries
+}
+
+// testSyncLifecycle syncs plugins through a series of config and remote
+// changes.
+func testSyncLifecycle(t *testing.T, remotes testRemotes) {
+	t.Helper()
+
+	cmd := testSyncEnv(t, remotes.backend())
+	foo := pluginSpec{Name: "foo", URL: remotes.url("foo"), Branch: "main"}
+	bar := pluginSpec{Name: "bar", URL: remotes.url("bar"), Branch: "main", Opt: true}
+
+	steps := []struct {
+		setup    func()
+		check    func()
+		name     string
+		pSpecs   func() []pluginSpec
+		expected []resultSummary
+		force    bool
+	}{
+		{
+			name: "install",
+			setup: func() {
+				remotes.commit(t, "foo", "main", "first foo")
+				remotes.commit(t, "bar", "main", "first bar")
+			},
+			pSpecs: func() []pluginSpec { return []pluginSpec{foo, bar} },
+			expected: []resultSummary{
+				{Plugin: "bar", Status: "installed"},
+				{Plugin: "foo", Status: "installed"},
+			},
+		},
+		{
+			name: "update",
+			setup: func() {
+				remotes.commit(t, "foo", "main", "second foo")
+			},
+			pSpecs: func() []pluginSpec { return []pluginSpec{foo, bar} },
+			expected: []resultSummary{
+				{Plugin: "bar", Status: "unchanged"},
+				{Plugin: "foo", Status: "updated", Commits: 1},
+			},
+		},
+		{
+			name:   "force push",
+			setup:  func() { remotes.rewrite(t, "foo", "main", "rewritten foo") },
+			pSpecs: func() []pluginSpec { return []pluginSpec{foo, bar} },
+			expected: []resultSummary{
+				{Plugin: "bar", Status: "unchanged"},
+				{Plugin: "foo", Status: "updated", Reason: "history rewritten"},
+			},
+		},
+		{
+			name:   "move",
+			setup:  func() { foo.Opt = true },
+			pSpecs: func() []pluginSpec { return []pluginSpec{foo, bar} },
+			expected: []resultSummary{
+				{Plugin: "bar", Status: "unchanged"},
+				{Plugin: "foo", Status: "unchanged", MovedTo: "opt"},
+			},
+		},
+		{
+			name: "switch branch",
+			setup: func() {
+				remotes.commit(t, "bar", "dev", "dev bar")
+				bar.Branch = "dev"
+			},
+			pSpecs: func() []pluginSpec { return []pluginSpec{foo, bar} },
+			expected: []resultSummary{
+				{Plugin: "bar", Status: "switched", Reason: "switching from branch main to dev"},
+				{Plugin: "foo", Status: "unchanged"},
+			},
+		},
+		{
+			name: "update locally modified",
+			setup: func() {
+				remotes.modify(t, cmd.pluginPath(foo))
+				remotes.commit(t, "foo", "main", "upstream foo")
+			},
+			pSpecs: func() []pluginSpec { return []pluginSpec{foo, bar} },
+			expected: []resultSummary{
+				{Plugin: "bar", Status: "unchanged"},
+				{Plugin: "foo", Status: "locally-modified", Reason: "uncommitted changes"},
+			},
+		},
+		{
+			name:   "forced update",
+			force:  true,
+			pSpecs: func() []pluginSpec { return []pluginSpec{foo, bar} },
+			expected: []resultSummary{
+				{Plugin: "bar", Status: "unchanged"},
+				{Plugin: "foo", Status: "updated", Commits: 1},
+			},
+		},
+		{
+			name: "pin to tag",
+			setup: func() {
+				remotes.tag(t, "foo", "v1.0.0")
+				remotes.commit(t, "foo", "main", "third foo")
+				foo.Tag = "v1.0.0"
+			},
+			pSpecs: func() []pluginSpec { return []pluginSpec{foo, bar} },
+			expected: []resultSummary{
+				{Plugin: "bar", Status: "unchanged"},
+				{Plugin: "foo", Status: "checked-out", Reason: "tag v1.0.0"},
+			},
+		},
+		{
+			name:   "locally modified",
+			setup:  func() { remotes.modify(t, cmd.pluginPath(bar)) },
+			pSpecs: func() []pluginSpec { return []pluginSpec{foo} },
+			expected: []resultSummary{
+				{Plugin: "bar", Status: "locally-modified", Reason: "uncommitted changes"},
+				{Plugin: "foo", Status: "unchanged"},
+			},
+		},
+		{
+			name:   "forced removal",
+			force:  true,
+			pSpecs: func() []pluginSpec { return []pluginSpec{foo} },
+			expected: []resultSummary{
+				{Plugin: "bar", Status: "removed"},
+				{Plugin: "foo", Status: "unchanged"},
+			},
+		},
+		{
+			name: "switch URL",
+			setup: func() {
+				remotes.mirror(t, "foo", "foo-mirror")
+				foo.URL = remotes.url("foo-mirror")
+			},
+			pSpecs: func() []pluginSpec { return []pluginSpec{foo} },
+			expected: []resultSummary{
+				{Plugin: "foo", Status: "switched", Reason: "plugin URL changed"},
+			},
+		},
+		{
+			name: "unrelated URL",
+			setup: func() {
+				remotes.commit(t, "other", "main", "first other")
+				remotes.tag(t, "other", "v1.0.0")
+				foo.URL = remotes.url("other")
+			},
+			pSpecs: func() []pluginSpec { return []pluginSpec{foo} },
+			expected: []resultSummary{
+				{Plugin: "foo", Status: "reinstalled", Reason: "plugin URL changed; no history in common"},
+			},
+		},
+		{
+			name:   "failed switch",
+			setup:  func() { foo.URL = remotes.url("missing") },
+			pSpecs: func() []pluginSpec { return []pluginSpec{foo} },
+			expected: []resultSummary{
+				{Plugin: "foo", Status: "failed"},
+			},
+			check: func() {
+				// The plugin must keep its old URL after a failed switch.
+				url, err := cmd.git.repoURL(t.Context(), cmd.pluginPath(foo))
+				if err != nil || url != remotes.url("other") {
+					t.Errorf("after failed switch, repoURL() = %q, %v; want %q", url, err, remotes.url("other"))
+				}
+			},
+		},
+	}
+
+	for _, step := range steps {
+		if step.setup != nil {
+			step.setup()
+		}
+		cmd.forceWanted = step.force
+
+		actual := runSync(t, cmd, step.pSpecs())
+		if diff := cmp.Diff(step.expected, actual); diff != "" {
+			t.Fatalf("sync after %q failure (-want +got)\n%s", step.name, diff)
+		}
+
+		if step.check != nil {
+			step.check()
+		}
+	}
+
+	// Nothing may be left behind in the staging directory.
+	if entries, err := filepath.Glob(filepath.Join(cmd.stagingDir, "*")); err != nil || len(entries) > 0 {
+		t.Errorf("staging directory not empty: %v", entries)
+	}
+}
+
+// testSyncDefaultBranch syncs a plugin that follows its remote's default
+// branch while the default changes.
+func testSyncDefaultBranch(t *testing.T, remotes testRemotes) {
+	t.Helper()
+
+	cmd := testSyncEnv(t, remotes.backend())
+	foo := pluginSpec{Name: "foo", URL: remotes.url("foo")}
+	remotes.commit(t, "foo", "main", "first foo")
+
+	steps := []struct {
+		setup    func()
+		name     string
+		expected []resultSummary
+	}{
+		{
+			name:     "install",
+			expected: []resultSummary{{Plugin: "foo", Status: "installed"}},
+		},
+		{
+			name:     "update",
+			setup:    func() { remotes.commit(t, "foo", "main", "second foo") },
+			expected: []resultSummary{{Plugin: "foo", Status: "updated", Commits: 1}},
+		},
+		{
+			name: "new default",
+			setup: func() {
+				remotes.commit(t, "foo", "trunk", "first trunk")
+				remotes.setDefault(t, "foo", "trunk")
+			},
+			expected: []resultSummary{
+				{Plugin: "foo", Status: "updated", Reason: "default branch changed from main to trunk"},
+			},
+		},
+		{
+			name:     "unchanged",
+			expected: []resultSummary{{Plugin: "foo", Status: "unchanged"}},
+		},
+	}
+
+	for _, step := range steps {
+		if step.setup != nil {
+			step.setup()
+		}
+
+		actual := runSync(t, cmd, []pluginSpec{foo})
+		if diff := cmp.Diff(step.expected, actual); diff != "" {
+			t.Fatalf("sync after %q failure (-want +got)\n%s", step.name, diff)
+		}
+	}
+}
+
+func TestSyncWithFakeGit(t *testing.T) {
+	t.Parallel()
+
+	t.Run("lifecycle", func(t *testing.T) {
+		t.Parallel()
+		testSyncLifecycle(t, newFakeGit())
+	})
+	t.Run("default branch", func(t *testing.T) {
+		t.Parallel()
+		testSyncDefaultBranch(t, newFakeGit())
+	})
+}
+
+func TestSyncWithGit(t *testing.T) {
+	t.Parallel()
+
+	t.Run("lifecycle", func(t *testing.T) {
+		t.Parallel()
+		testSyncLifecycle(t, newGitRemotes(t))
+	})
+	t.Run("default branch", func(t *testing.T) {
+		t.Parallel()
+		testSyncDefaultBranch(t, newGitRemotes(t))
+	})
+}
+
+func TestSyncSubmodules(t *testing.T) {
+	// Git refuses to clone submodules from local paths unless told to.
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "protocol.file.allow")
+	t.Setenv("GIT_CONFIG_VALUE_0", "always")
+
+	remotes := newGitRemotes(t)
+	remotes.commit(t, "lib", "main", "first lib")
+	remotes.commit(t, "foo", "main", "first foo")
+	work := filepath.Join(remotes.root, "foo.work")
+	mustGit(t, work, "submodule", "--quiet", "add", remotes.url("lib"), "lib")
+	mustGit(t, work, "commit", "--quiet", "-m", "add lib")
+	mustGit(t, work, "push", "--quiet", "origin", "main")
+
+	foo := pluginSpec{Name: "foo", URL: remotes.url("foo"), Branch: "main"}
+	libFile := func(cmd *cmdEnv, pSpec pluginSpec) string {
+		data, err := os.ReadFile(filepath.Join(cmd.pluginPath(pSpec), "lib", "file.txt"))
+		if err != nil {
+			return ""
+		}
+
+		return string(data)
+	}
+
+	cmd := testSyncEnv(t, remotes.backend())
+	runSync(t, cmd, []pluginSpec{foo})
+	if actual := libFile(cmd, foo); actual != "first lib\n" {
+		t.Errorf("after install, lib/file.txt = %q; want %q", actual, "first lib\n")
+	}
+
+	// Move the submodule forward.
+	remotes.commit(t, "lib", "main", "second lib")
+	mustGit(t, filepath.Join(work, "lib"), "pull", "--quiet", "origin", "main")
+	mustGit(t, work, "commit", "--quiet", "-am", "update lib")
+	mustGit(t, work, "push", "--quiet", "origin", "main")
+
+	runSync(t, cmd, []pluginSpec{foo})
+	if actual := libFile(cmd, foo); actual != "second lib\n" {
+		t.Errorf("after update, lib/file.txt = %q; want %q", actual, "second lib\n")
+	}
+
+	skipping := testSyncEnv(t, remotes.backend())
+	foo.SkipSubmodules = true
+	runSync(t, skipping, []pluginSpec{foo})
+	if actual := libFile(skipping, foo); actual != "" {
+		t.Errorf("with skipSubmodules, lib/file.txt = %q; want no file", actual)
+	}
+}
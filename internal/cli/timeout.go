@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultCloneTimeout  = duration(2 * time.Minute)
+	defaultUpdateTimeout = duration(1 * time.Minute)
+	// Building plugins can take far longer than git operations.
+	defaultBuildTimeout = duration(5 * time.Minute)
+)
+
+// duration is a time.Duration that config files write as a string, such as
+// "90s" or "5m".
+type duration time.Duration
+
+func (d *duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	if v <= 0 {
+		return fmt.Errorf("duration %q must be positive", text)
+	}
+	*d = duration(v)
+
+	return nil
+}
+
+// timeouts limits how long git operations that use the network and build
+// commands may run. Clone covers installing a plugin; Update covers fetching,
+// checking out, and restoring one; Build covers its build command. A zero
+// value means that a timeout is not set.
+type timeouts struct {
+	Clone  duration `json:"clone"`
+	Update duration `json:"update"`
+	Build  duration `json:"build"`
+}
+
+// merge returns t with any timeouts that other sets.
+func (t timeouts) merge(other timeouts) timeouts {
+	if other.Clone != 0 {
+		t.Clone = other.Clone
+	}
+
+	if other.Update != 0 {
+		t.Update = other.Update
+	}
+
+	if other.Build != 0 {
+		t.Build = other.Build
+	}
+
+	return t
+}
+
+// timeoutsFor returns the timeouts for a plugin's git operations and build. A plugin's
+// own timeouts win over the config's, which win over the defaults.
+func (cmd *cmdEnv) timeoutsFor(pSpec pluginSpec) timeouts {
+	t := timeouts{
+		Clone:  defaultCloneTimeout,
+		Update: defaultUpdateTimeout,
+		Build:  defaultBuildTimeout,
+	}
+
+	return t.merge(cmd.timeouts).merge(pSpec.Timeout)
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTimeoutsFor(t *testing.T) {
+	t.Parallel()
+
+	expected := map[string]timeouts{
+		"small": {Clone: duration(5 * time.Minute), Update: defaultUpdateTimeout, Build: defaultBuildTimeout},
+		"huge": {
+			Clone:  duration(20 * time.Minute),
+			Update: duration(90 * time.Second),
+			Build:  duration(15 * time.Minute),
+		},
+	}
+
+	for _, confFile := range []string{"testdata/timeouts.json", "testdata/timeouts.toml"} {
+		t.Run(confFile, func(t *testing.T) {
+			t.Parallel()
+
+			cmd := fakeCmdEnv(confFile)
+			pSpecs, err := cmd.plugins()
+			if err != nil {
+				t.Fatalf("test cannot finish since cmd.plugins() failed: %v", err)
+			}
+
+			actual := make(map[string]timeouts, len(pSpecs))
+			for _, pSpec := range pSpecs {
+				actual[pSpec.Name] = cmd.timeoutsFor(pSpec)
+			}
+
+			if diff := cmp.Diff(expected, actual); diff != "" {
+				t.Errorf("cmd.timeoutsFor() with %q failure (-want +got)\n%s", confFile, diff)
+			}
+		})
+	}
+}
+
+func TestDurationErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"not a string": `{"clone": 300}`,
+		"no unit":      `{"clone": "300"}`,
+		"negative":     `{"clone": "-5m"}`,
+		"zero":         `{"update": "0s"}`,
+	}
+
+	for msg, data := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			var to timeouts
+			if err := json.Unmarshal([]byte(data), &to); err == nil {
+				t.Errorf("json.Unmarshal(%s) returned no error", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2/unstable"
+)
+
+// parseTOML parses a TOML document into the same tree that parseJSON returns,
+// so that a TOML config is decoded and checked just like a JSON one. Offsets
+// point into the TOML document. Values that the parser does not locate, such
+// as booleans and arrays, take the offset of their key.
+func parseTOML(data []byte) (*jsonValue, error) {
+	var p unstable.Parser
+	p.Reset(data)
+
+	tt := tomlTree{
+		root:   &jsonValue{kind: objectKind},
+		defs:   make(map[*jsonValue]tomlDef),
+		arrays: make(map[*jsonValue]bool),
+	}
+	table := tt.root
+	for p.NextExpression() {
+		expr := p.Expression()
+
+		var err error
+		switch expr.Kind {
+		case unstable.KeyValue:
+			err = tt.setKey(table, expr)
+		case unstable.Table:
+			table, err = tt.table(tomlKey(expr))
+		case unstable.ArrayTable:
+			table, err = tt.arrayTable(tomlKey(expr))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.Error(); err != nil {
+		return nil, tomlSyntaxError(&p, data, err)
+	}
+
+	if err := tt.root.encode(); err != nil {
+		return nil, err
+	}
+
+	return tt.root, nil
+}
+
+// tomlKeyPart is one part of a dotted key such as a.b.c.
+type tomlKeyPart struct {
+	name   string
+	offset int64
+}
+
+func tomlKey(expr *unstable.Node) []tomlKeyPart {
+	var parts []tomlKeyPart
+	for it := expr.Key(); it.Next(); {
+		node := it.Node()
+		parts = append(parts, tomlKeyPart{name: string(node.Data), offset: int64(node.Raw.Offset)})
+	}
+
+	return parts
+}
+
+// tomlDef records how a TOML table was defined.
+type tomlDef int
+
+const (
+	// tomlImplied tables were only named on the way to another table, as
+	// [a.b] names a, and they may be defined once later.
+	tomlImplied tomlDef = iota
+	tomlHeader          // By a header such as [a]
+	tomlDotted          // By a dotted key such as a.b = 1
+	tomlInline          // By an inline table, which nothing may extend
+)
+
+// tomlTree builds the tree that parseTOML returns and keeps track of what
+// TOML forbids defining twice.
+type tomlTree struct {
+	root *jsonValue
+	defs map[*jsonValue]tomlDef
+	// arrays holds the arrays that [[...]] headers made. Headers may add to
+	// these arrays but not to arrays written as values.
+	arrays map[*jsonValue]bool
+}
+
+func tomlErrorf(part tomlKeyPart, format string) error {
+	return &configSyntaxError{msg: "invalid TOML: " + fmt.Sprintf(format, part.name), offset: part.offset}
+}
+
+// table returns the table that a header such as [a.b] defines, creating it
+// and any tables above it as needed.
+func (tt *tomlTree) table(key []tomlKeyPart) (*jsonValue, error) {
+	parent, err := tt.subtables(key[:len(key)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	last := key[len(key)-1]
+	v := parent.field(last.name)
+	switch {
+	case v == nil:
+		v = addTOMLField(parent, last, objectKind)
+	case tt.arrays[v]:
+		return nil, tomlErrorf(last, "%q is an array of tables")
+	case v.kind != objectKind:
+		return nil, tomlErrorf(last, "%q is not a table")
+	case tt.defs[v] != tomlImplied:
+		return nil, tomlErrorf(last, "duplicate table %q")
+	}
+	tt.defs[v] = tomlHeader
+
+	return v, nil
+}
+
+// arrayTable adds a new table to the array that a header such as
+// [[plugins]] names and returns the new table.
+func (tt *tomlTree) arrayTable(key []tomlKeyPart) (*jsonValue, error) {
+	parent, err := tt.subtables(key[:len(key)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	last := key[len(key)-1]
+	array := parent.field(last.name)
+	switch {
+	case array == nil:
+		array = addTOMLField(parent, last, arrayKind)
+		tt.arrays[array] = true
+	case !tt.arrays[array]:
+		return nil, tomlErrorf(last, "%q is not an array of tables")
+	}
+
+	table := &jsonValue{kind: objectKind, offset: last.offset}
+	array.items = append(array.items, table)
+	tt.defs[table] = tomlHeader
+
+	return table, nil
+}
+
+// subtables returns the table that the parts of a header before the last one
+// name, creating any tables that do not exist yet. A part that names an array
+// of tables stands for the last table in the array.
+func (tt *tomlTree) subtables(key []tomlKeyPart) (*jsonValue, error) {
+	table := tt.root
+	for _, part := range key {
+		v := table.field(part.name)
+		switch {
+		case v == nil:
+			v = addTOMLField(table, part, objectKind)
+		case tt.arrays[v]:
+			v = v.items[len(v.items)-1]
+		case v.kind != objectKind:
+			return nil, tomlErrorf(part, "%q is not a table")
+		case tt.defs[v] == tomlInline:
+			return nil, tomlErrorf(part, "cannot add to inline table %q")
+		}
+		table = v
+	}
+
+	return table, nil
+}
+
+// setKey adds a key and its value, such as a.b = 1, to a table. Each part of
+// a dotted key but the last defines a table, unless an earlier dotted key in
+// the same table defined it already.
+func (tt *tomlTree) setKey(table *jsonValue, expr *unstable.Node) error {
+	key := tomlKey(expr)
+	parent := table
+	for _, part := range key[:len(key)-1] {
+		v := parent.field(part.name)
+		switch {
+		case v == nil:
+			v = addTOMLField(parent, part, objectKind)
+			tt.defs[v] = tomlDotted
+		case v.kind != objectKind:
+			return tomlErrorf(part, "%q is not a table")
+		case tt.defs[v] == tomlImplied:
+			tt.defs[v] = tomlDotted
+		case tt.defs[v] != tomlDotted:
+			return tomlErrorf(part, "duplicate table %q")
+		}
+		parent = v
+	}
+
+	// TOML forbids defining a key twice.
+	last := key[len(key)-1]
+	if parent.field(last.name) != nil {
+		return tomlErrorf(last, "duplicate key %q")
+	}
+
+	v, err := tt.value(expr.Value(), last.offset)
+	if err != nil {
+		return err
+	}
+	parent.fields = append(parent.fields, jsonField{key: last.name, offset: last.offset, value: v})
+
+	return nil
+}
+
+// addTOMLField adds an empty object or array to a table at a key and returns
+// it.
+func addTOMLField(table *jsonValue, part tomlKeyPart, kind jsonKind) *jsonValue {
+	v := &jsonValue{kind: kind, offset: part.offset}
+	table.fields = append(table.fields, jsonField{key: part.name, offset: part.offset, value: v})
+
+	return v
+}
+
+// value converts a TOML value to a jsonValue. If the parser did not locate
+// the value, it takes the offset given.
+func (tt *tomlTree) value(node *unstable.Node, offset int64) (*jsonValue, error) {
+	if node.Raw.Length > 0 {
+		offset = int64(node.Raw.Offset)
+	}
+	v := &jsonValue{kind: scalarKind, offset: offset}
+
+	switch node.Kind {
+	case unstable.Array:
+		v.kind = arrayKind
+		for it := node.Children(); it.Next(); {
+			item, err := tt.value(it.Node(), offset)
+			if err != nil {
+				return nil, err
+			}
+			v.items = append(v.items, item)
+		}
+	case unstable.InlineTable:
+		v.kind = objectKind
+		for it := node.Children(); it.Next(); {
+			if err := tt.setKey(v, it.Node()); err != nil {
+				return nil, err
+			}
+		}
+		tt.defs[v] = tomlInline
+	case unstable.Bool:
+		v.raw = node.Data
+	case unstable.Integer:
+		s := strings.ReplaceAll(string(node.Data), "_", "")
+		base := 10
+		if len(s) > 1 && s[0] == '0' {
+			// Only 0x, 0o, and 0b may follow a leading zero.
+			base = 0
+		}
+		n, err := strconv.ParseInt(s, base, 64)
+		if err != nil {
+			return nil, &configSyntaxError{msg: fmt.Sprintf("invalid TOML: invalid integer %s", node.Data), offset: offset}
+		}
+		v.raw = strconv.AppendInt(nil, n, 10)
+	case unstable.Float:
+		f, err := strconv.ParseFloat(strings.ReplaceAll(string(node.Data), "_", ""), 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			// JSON has no infinities or NaNs, and no setting needs one.
+			return v, v.setString(node.Data)
+		}
+		v.raw = strconv.AppendFloat(nil, f, 'g', -1, 64)
+	default:
+		// Strings, and dates and times as they were written.
+		return v, v.setString(node.Data)
+	}
+
+	return v, nil
+}
+
+// setString sets a value's JSON to a string.
+func (v *jsonValue) setString(s []byte) error {
+	raw, err := json.Marshal(string(s))
+	if err != nil {
+		return err
+	}
+	v.raw = raw
+
+	return nil
+}
+
+// encode fills in the JSON of objects and arrays from the JSON of their
+// contents.
+func (v *jsonValue) encode() error {
+	var buf []byte
+	switch v.kind {
+	case objectKind:
+		buf = append(buf, '{')
+		for i, f := range v.fields {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			key, err := json.Marshal(f.key)
+			if err != nil {
+				return err
+			}
+			buf = append(buf, key...)
+			buf = append(buf, ':')
+			if err := f.value.encode(); err != nil {
+				return err
+			}
+			buf = append(buf, f.value.raw...)
+		}
+		buf = append(buf, '}')
+	case arrayKind:
+		buf = append(buf, '[')
+		for i, item := range v.items {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			if err := item.encode(); err != nil {
+				return err
+			}
+			buf = append(buf, item.raw...)
+		}
+		buf = append(buf, ']')
+	default:
+		return nil
+	}
+
+	v.raw = buf
+
+	return nil
+}
+
+// tomlSyntaxError converts the parser's error into a configSyntaxError.
+func tomlSyntaxError(p *unstable.Parser, data []byte, err error) error {
+	var parserErr *unstable.ParserError
+	if !errors.As(err, &parserErr) {
+		return &configSyntaxError{msg: "invalid TOML: " + err.Error(), offset: int64(len(data))}
+	}
+
+	// Range panics unless the highlighted bytes are a slice of data.
+	offset := int64(len(data))
+	if parserErr.Highlight != nil {
+		offset = int64(p.Range(parserErr.Highlight).Offset)
+	}
+
+	return &configSyntaxError{msg: "invalid TOML: " + parserErr.Message, offset: offset}
+}
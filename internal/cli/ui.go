@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -51,52 +52,128 @@ func (s *spinner) stop() {
 
 // reporter handles progress display and result formatting.
 type reporter struct {
-	spinner     *spinner
-	indent      string
-	quietWanted bool
+	spinner         *spinner
+	indent          string
+	command         string
+	jsonWanted      bool
+	quietWanted     bool
+	changelogWanted bool
 }
 
-func newReporter(indent string, quietWanted bool) *reporter {
+func newReporter(indent string, cmd *cmdEnv) *reporter {
 	return &reporter{
-		indent:      indent,
-		quietWanted: quietWanted,
+		indent:          indent,
+		command:         cmd.subcmd,
+		jsonWanted:      cmd.format == formatJSON,
+		quietWanted:     cmd.quietWanted,
+		changelogWanted: cmd.changelogWanted,
 	}
 }
 
 func (r *reporter) start(banner string) {
-	if !r.quietWanted {
+	// A spinner would only get in the way of programs that read JSON.
+	if !r.quietWanted && !r.jsonWanted {
 		r.spinner = newSpinner()
 		r.spinner.start(banner)
 	}
 }
 
-func (r *reporter) finish(results []result) {
+func (r *reporter) stop() {
 	if r.spinner != nil {
 		r.spinner.stop()
+		r.spinner = nil
 	}
+}
+
+func (r *reporter) finish(results []result) error {
+	r.stop()
 
-	if r.quietWanted {
+	switch {
+	case r.jsonWanted:
+		return writeJSONResults(os.Stdout, r.command, results)
+	case r.quietWanted:
 		r.printErrorsOnly(results)
-		return
+	default:
+		r.printFull(results)
+	}
+
+	return nil
+}
+
+// finishPlan prints the actions in a plan. A plan is printed in full even in
+// quiet mode since printing it is the whole point of a dry run.
+func (r *reporter) finishPlan(p plan) error {
+	r.stop()
+
+	if r.jsonWanted {
+		return writeJSONPlan(os.Stdout, r.command, p)
+	}
+
+	for _, act := range p.removals {
+		fmt.Println(r.formatAction(act))
 	}
 
-	r.printFull(results)
+	for _, act := range p.actions {
+		fmt.Println(r.formatAction(act))
+	}
+
+	return nil
 }
 
 func (r *reporter) printFull(results []result) {
 	for _, res := range results {
 		fmt.Println(r.formatResult(res))
+		r.printHint(res)
+		r.printBuildOutput(res)
+		r.printChangelog(res)
+	}
+}
+
+// printChangelog lists the commits that an update pulled in.
+func (r *reporter) printChangelog(res result) {
+	if !r.changelogWanted || res.err != nil {
+		return
+	}
+
+	for _, commit := range res.commits {
+		fmt.Printf("%s%s%s\n", r.indent, r.indent, commit)
 	}
 }
 
 func (r *reporter) printErrorsOnly(results []result) {
 	for _, res := range results {
 		if res.err != nil {
-			fmt.Printf("%sfailed: %s\n", r.indent, res.plugin)
+			fmt.Printf("%s%s: %s\n", r.indent, r.formatStatus(res), res.plugin)
+			r.printHint(res)
+			r.printBuildOutput(res)
 		}
 	}
 }
 
+// printHint suggests how to fix a failure whose class is known.
+func (r *reporter) printHint(res result) {
+	if class := classOf(res.err); class != nil {
+		fmt.Printf("%s%shint: %s\n", r.indent, r.indent, class.hint)
+	}
+}
+
+// printBuildOutput shows what a failed build command printed.
+func (r *reporter) printBuildOutput(res result) {
+	var bErr *buildError
+	if !errors.As(res.err, &bErr) {
+		return
+	}
+
+	output := strings.TrimRight(string(bErr.output), "\n")
+	if output == "" {
+		return
+	}
+
+	for line := range strings.SplitSeq(output, "\n") {
+		fmt.Printf("%s%s| %s\n", r.indent, r.indent, line)
+	}
+}
+
 func (r *reporter) formatResult(res result) string {
 	var msg strings.Builder
 	msg.WriteString(r.indent)
@@ -109,6 +186,13 @@ func (r *reporter) formatResult(res result) string {
 
 func (r *reporter) formatStatus(res result) string {
 	if res.err != nil {
+		if res.status == buildFailed {
+			return "build failed"
+		}
+		if class := classOf(res.err); class != nil {
+			return "failed (" + class.desc + ")"
+		}
+
 		return "failed"
 	}
 
@@ -119,10 +203,22 @@ func (r *reporter) formatStatus(res result) string {
 		return "removed"
 	case reinstalled:
 		return r.formatReinstalled(res)
+	case switched:
+		return r.formatSwitched(res)
 	case updated:
 		return r.formatUpdated(res)
+	case restored:
+		return r.formatRestored(res)
+	case checkedOut:
+		return r.formatCheckedOut(res)
+	case skipped:
+		return "skipped (" + res.reason + ")"
 	case unchanged:
 		return r.formatUnchanged(res)
+	case unmanaged:
+		return "unmanaged (not in config, kept)"
+	case modified:
+		return "locally modified (" + res.reason + "; use --force to override)"
 	default:
 		panic(fmt.Sprintf("unreachable: invalid status %d", res.status))
 	}
@@ -136,12 +232,48 @@ func (r *reporter) formatReinstalled(res result) string {
 	return "reinstalled"
 }
 
+func (r *reporter) formatSwitched(res result) string {
+	msg := "switched in place (" + res.reason + ")"
+	if res.movedTo != "" {
+		return msg + " and moved to " + res.movedTo + "/"
+	}
+
+	return msg
+}
+
 func (r *reporter) formatUpdated(res result) string {
+	msg := "updated"
+	switch n := len(res.commits); {
+	case res.reason != "":
+		msg += " (" + res.reason + ")"
+	case n == 0:
+	case n == 1:
+		msg += " (1 new commit)"
+	default:
+		msg += fmt.Sprintf(" (%d new commits)", n)
+	}
+
 	if res.movedTo != "" {
-		return "updated and moved to " + res.movedTo + "/"
+		return msg + " and moved to " + res.movedTo + "/"
 	}
 
-	return "updated"
+	return msg
+}
+
+func (r *reporter) formatRestored(res result) string {
+	if res.movedTo != "" {
+		return "restored to locked commit and moved to " + res.movedTo + "/"
+	}
+
+	return "restored to locked commit"
+}
+
+func (r *reporter) formatCheckedOut(res result) string {
+	if res.movedTo != "" {
+		return "checked out " + res.reason + " and moved to " + res.movedTo + "/"
+	}
+
+	return "checked out " + res.reason
 }
 
 func (r *reporter) formatUnchanged(res result) string {
@@ -163,3 +295,93 @@ func (r *reporter) formatUnchanged(res result) string {
 	// Case 3: the plugin wasn't moved and there were no updates.
 	return "already up-to-date"
 }
+
+func (r *reporter) formatAction(act action) string {
+	var msg strings.Builder
+	msg.WriteString(r.indent)
+	msg.WriteString(act.plugin)
+	msg.WriteString(": ")
+	msg.WriteString(r.formatPlanned(act))
+	msg.WriteString(r.formatPlannedBuild(act))
+
+	return msg.String()
+}
+
+func (r *reporter) formatPlannedBuild(act action) string {
+	if act.pSpec.Build == "" {
+		return ""
+	}
+
+	switch act.kind {
+	case installAction, switchAction, checkoutAction:
+		return " (then build)"
+	case updateAction:
+		if act.commit != nil || !act.pSpec.frozen() {
+			return " (then build if changed)"
+		}
+
+		return ""
+	default:
+		return ""
+	}
+}
+
+func (r *reporter) formatPlanned(act action) string {
+	switch act.kind {
+	case installAction:
+		if act.commit != nil {
+			return "would install at locked commit " + act.commit.short()
+		}
+
+		return "would install"
+	case switchAction:
+		if act.moveTo != "" {
+			return "would move to " + act.moveTo + "/ and switch in place (" + act.reason + ")"
+		}
+
+		return "would switch in place (" + act.reason + ")"
+	case removeAction:
+		return "would remove"
+	case skipAction:
+		return "would skip (" + act.reason + ")"
+	case keepAction:
+		return "unmanaged (not in config, kept)"
+	case modifiedAction:
+		return "would skip (locally modified: " + act.reason + ")"
+	case updateAction:
+		return r.formatPlannedUpdate(act)
+	case checkoutAction:
+		if act.moveTo != "" {
+			return "would move to " + act.moveTo + "/ and check out " + act.reason
+		}
+
+		return "would check out " + act.reason
+	default:
+		panic(fmt.Sprintf("unreachable: invalid action %d", act.kind))
+	}
+}
+
+func (r *reporter) formatPlannedUpdate(act action) string {
+	steps := make([]string, 0, 2)
+	if act.moveTo != "" {
+		steps = append(steps, "move to "+act.moveTo+"/")
+	}
+
+	switch {
+	case act.commit != nil:
+		steps = append(steps, "restore to locked commit "+act.commit.short())
+	case !act.pSpec.frozen():
+		steps = append(steps, "update")
+	}
+
+	if len(steps) == 0 {
+		return "pinned (no update planned)"
+	}
+
+	msg := "would " + strings.Join(steps, " and ")
+	if act.pSpec.frozen() && act.commit == nil {
+		msg += " (pinned, no update planned)"
+	}
+
+	return msg
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestFormatStatus(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		expected string
+		res      result
+	}{
+		"failed":            {res: result{err: errors.New("boom"), status: updated}, expected: "failed"},
+		"failed with class": {res: result{err: fmt.Errorf("clone failed: %w", &gitError{op: "git clone", stderr: "fatal: repository 'x' not found"}), status: installed}, expected: "failed (repository not found)"},
+		"build failed":      {res: result{err: errors.New("boom"), status: buildFailed}, expected: "build failed"},
+		"updated":           {res: result{status: updated}, expected: "updated"},
+		"updated one":       {res: result{status: updated, commits: []string{"a"}}, expected: "updated (1 new commit)"},
+		"updated many":      {res: result{status: updated, commits: []string{"a", "b"}}, expected: "updated (2 new commits)"},
+		"updated and moved": {res: result{status: updated, commits: []string{"a"}, movedTo: "opt"}, expected: "updated (1 new commit) and moved to opt/"},
+		"pinned":            {res: result{status: unchanged, pinned: true}, expected: "pinned (no update attempted)"},
+		"checked out":       {res: result{status: checkedOut, reason: "tag v1"}, expected: "checked out tag v1"},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			r := newReporter("", &cmdEnv{})
+			if actual := r.formatStatus(tc.res); actual != tc.expected {
+				t.Errorf("r.formatStatus(%+v) = %q; want %q", tc.res, actual, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,380 @@
+package cli
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// problem is a mistake in a config file and where it is.
+type problem struct {
+	msg    string
+	offset int64
+}
+
+// validate checks the config file without touching any plugins and prints
+// every problem that it finds. It reports whether the config is valid.
+func (cmd *cmdEnv) validate() bool {
+	data, err := os.ReadFile(cmd.confFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: cannot read config %q: %s\n", cmd.name, cmd.confFile, err)
+		return false
+	}
+
+	problems := checkConfig(cmd.confFile, data, cmd.homeDir, os.LookupEnv)
+	if cmd.format == formatJSON {
+		if err := writeJSONProblems(os.Stdout, cmd.confFile, data, problems); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", cmd.name, err)
+			return false
+		}
+
+		return len(problems) == 0
+	}
+
+	for _, prob := range problems {
+		line, col := position(data, prob.offset)
+		fmt.Printf("%s:%d:%d: %s\n", cmd.confFile, line, col, prob.msg)
+	}
+
+	if len(problems) == 0 && !cmd.quietWanted {
+		fmt.Printf("%s: %s is valid\n", cmd.name, cmd.confFile)
+	}
+
+	return len(problems) == 0
+}
+
+// writeJSONProblems writes a JSON document that lists every problem.
+func writeJSONProblems(w io.Writer, confFile string, data []byte, problems []problem) error {
+	type jsonProblem struct {
+		Message string `json:"message"`
+		Line    int    `json:"line"`
+		Column  int    `json:"column"`
+	}
+
+	doc := struct {
+		Config   string        `json:"config"`
+		Problems []jsonProblem `json:"problems"`
+		Valid    bool          `json:"valid"`
+	}{
+		Config:   confFile,
+		Problems: make([]jsonProblem, 0, len(problems)),
+		Valid:    len(problems) == 0,
+	}
+
+	for _, prob := range problems {
+		line, col := position(data, prob.offset)
+		doc.Problems = append(doc.Problems, jsonProblem{Message: prob.msg, Line: line, Column: col})
+	}
+
+	return writeJSON(w, doc)
+}
+
+// position converts a byte offset to a line and column, both counted from 1.
+// Columns count bytes.
+func position(data []byte, offset int64) (int, int) {
+	before := data[:min(offset, int64(len(data)))]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+
+	return line, col
+}
+
+// checkConfig returns every problem in a config file in order by position. It
+// expands dataDir against homeDir and the variables that lookupEnv finds.
+func checkConfig(confFile string, data []byte, homeDir string, lookupEnv func(string) (string, bool)) []problem {
+	root, err := parseConfig(confFile, data)
+	if err != nil {
+		var syntaxErr *configSyntaxError
+		if errors.As(err, &syntaxErr) {
+			return []problem{{msg: syntaxErr.msg, offset: syntaxErr.offset}}
+		}
+
+		return []problem{{msg: err.Error()}}
+	}
+
+	c := configChecker{data: data, homeDir: homeDir, lookupEnv: lookupEnv}
+	c.checkValue(root, configType, "the config")
+	if root.kind == objectKind {
+		cfg := decodeSettings(root)
+		c.checkSettings(root, cfg)
+		c.checkPlugins(root, cfg)
+	}
+
+	slices.SortStableFunc(c.problems, func(a, b problem) int {
+		return cmp.Compare(a.offset, b.offset)
+	})
+
+	return c.problems
+}
+
+// configChecker collects problems as it walks a config file.
+type configChecker struct {
+	lookupEnv func(string) (string, bool)
+	homeDir   string
+	data      []byte
+	problems  []problem
+}
+
+func (c *configChecker) addf(offset int64, format string, args ...any) {
+	c.problems = append(c.problems, problem{msg: fmt.Sprintf(format, args...), offset: offset})
+}
+
+// checkValue checks that a value has a type, including unknown and duplicate
+// keys in objects. The label names the value in messages.
+func (c *configChecker) checkValue(v *jsonValue, t keyType, label string) {
+	switch {
+	case t.keys != nil && v.kind == objectKind:
+		c.checkObject(v, t.keys)
+	case t.item != nil && v.kind == arrayKind:
+		for _, item := range v.items {
+			c.checkValue(item, *t.item, "each item in "+label)
+		}
+	default:
+		err := t.decode(v.raw)
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &typeErr):
+			c.addf(v.offset, "%s must be %s, not %s", label, t.name, typeErr.Value)
+		case err != nil:
+			c.addf(v.offset, "invalid %s: %s", label, err)
+		}
+	}
+}
+
+func (c *configChecker) checkObject(v *jsonValue, keys map[string]keyType) {
+	seen := make(map[string]bool, len(v.fields))
+
+	for _, f := range v.fields {
+		if seen[f.key] {
+			c.addf(f.offset, "duplicate key %q", f.key)
+		}
+		seen[f.key] = true
+
+		t, ok := keys[f.key]
+		if !ok {
+			c.addf(f.offset, "unknown key %q", f.key)
+			continue
+		}
+
+		c.checkValue(f.value, t, strconv.Quote(f.key))
+	}
+}
+
+// checkSettings checks the values of the config's settings other than
+// plugins.
+func (c *configChecker) checkSettings(root *jsonValue, cfg config) {
+	offset := root.offset
+	if v := root.field("dataDir"); v != nil {
+		offset = v.offset
+	}
+	dataDir, err := expandPath(filepath.Join(cfg.DataDir...), c.homeDir, c.lookupEnv)
+	switch {
+	case err != nil:
+		c.addf(offset, "cannot expand dataDir: %s", err)
+	case dataDir == "":
+		c.addf(offset, "dataDir is required")
+	}
+
+	if v := root.field("keep"); v != nil && v.kind == arrayKind {
+		for _, item := range v.items {
+			var pattern string
+			if json.Unmarshal(item.raw, &pattern) != nil {
+				continue
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				c.addf(item.offset, "invalid keep pattern %q: %s", pattern, err)
+			}
+		}
+	}
+
+	// Zero means the default.
+	if v := root.field("attempts"); v != nil && cfg.Attempts < 0 {
+		c.addf(v.offset, "attempts must be at least 1")
+	}
+
+	if v := root.field("urlTemplate"); v != nil && cfg.URLTemplate != "" &&
+		!strings.Contains(cfg.URLTemplate, urlPlaceholder) {
+		c.addf(v.offset, "urlTemplate must contain %s", urlPlaceholder)
+	}
+}
+
+// checkPlugins checks each plugin and looks for plugins that share a name or
+// URL, as pluggo sees them after expanding shorthand URLs and deriving names.
+func (c *configChecker) checkPlugins(root *jsonValue, cfg config) {
+	plugins := root.field("plugins")
+	if plugins == nil || plugins.kind != arrayKind {
+		return
+	}
+
+	urlTemplate := cmp.Or(cfg.URLTemplate, defaultURLTemplate)
+
+	names := make(map[string]int64)
+	urls := make(map[string]int64)
+	for _, item := range plugins.items {
+		if item.kind != objectKind {
+			continue
+		}
+
+		pSpec := decodePlugin(item)
+		pSpec.URL = expandURL(pSpec.URL, urlTemplate)
+		if pSpec.Name == "" {
+			pSpec.Name = nameFromURL(pSpec.URL, cfg.StripPrefixes)
+		}
+
+		c.checkPlugin(item, pSpec)
+		c.checkUnique(names, pSpec.Name, "name", item.fieldOffset("name", "url"))
+		c.checkUnique(urls, pSpec.URL, "url", item.fieldOffset("url"))
+	}
+}
+
+// decodeSettings decodes the settings that checkSettings and checkPlugins
+// look at. A setting with the wrong type is left as the zero value, since
+// checkValue reports it.
+func decodeSettings(root *jsonValue) config {
+	var cfg config
+	decodeField(root, "dataDir", &cfg.DataDir)
+	decodeField(root, "attempts", &cfg.Attempts)
+	decodeField(root, "urlTemplate", &cfg.URLTemplate)
+	decodeField(root, "stripPrefixes", &cfg.StripPrefixes)
+
+	return cfg
+}
+
+// decodePlugin decodes the fields of a plugin that checkPlugin looks at, in
+// the same way as decodeSettings.
+func decodePlugin(item *jsonValue) pluginSpec {
+	var pSpec pluginSpec
+	decodeField(item, "url", &pSpec.URL)
+	decodeField(item, "name", &pSpec.Name)
+	decodeField(item, "commit", &pSpec.Commit)
+	decodeField(item, "tag", &pSpec.Tag)
+	decodeField(item, "pin", &pSpec.Pinned)
+
+	return pSpec
+}
+
+// decodeField sets dst to the value of an object's key if the key is there and
+// its value fits dst.
+func decodeField[T any](obj *jsonValue, key string, dst *T) {
+	v := obj.field(key)
+	if v == nil {
+		return
+	}
+
+	var value T
+	if err := json.Unmarshal(v.raw, &value); err != nil {
+		// checkValue reports values with the wrong type.
+		return
+	}
+	*dst = value
+}
+
+func (c *configChecker) checkPlugin(item *jsonValue, pSpec pluginSpec) {
+	if pSpec.URL == "" {
+		c.addf(item.fieldOffset("url"), "plugin has no url")
+		return
+	}
+
+	if err := checkName(pSpec.Name); err != nil {
+		c.addf(item.fieldOffset("name", "url"), "%s", err)
+	}
+
+	if pSpec.Commit != "" && pSpec.Tag != "" {
+		c.addf(item.fieldOffset("tag"), "plugin %q has both a commit and a tag", pSpec.Name)
+	}
+
+	if pSpec.Pinned && pSpec.ref() != "" {
+		c.addf(item.fieldOffset("pin"), "plugin %q has both pin and a commit or tag; use one or the other", pSpec.Name)
+	}
+}
+
+// checkUnique reports a value that an earlier plugin already has.
+func (c *configChecker) checkUnique(seen map[string]int64, value, key string, offset int64) {
+	if value == "" {
+		return
+	}
+
+	if first, ok := seen[value]; ok {
+		line, _ := position(c.data, first)
+		c.addf(offset, "duplicate plugin %s %q (first used on line %d)", key, value, line)
+		return
+	}
+	seen[value] = offset
+}
+
+// keyType describes the JSON that a config key takes.
+type keyType struct {
+	decode func([]byte) error // Reports whether a value has the type
+	keys   map[string]keyType // For objects, the keys that they may have
+	item   *keyType           // For arrays of objects, the type of each item
+	name   string             // Such as "a string", for messages
+}
+
+// jsonType returns the keyType of values that decode into a T.
+func jsonType[T any](name string) keyType {
+	return keyType{name: name, decode: func(raw []byte) error {
+		var v T
+		return json.Unmarshal(raw, &v)
+	}}
+}
+
+func objectType(keys map[string]keyType) keyType {
+	t := jsonType[map[string]json.RawMessage]("an object")
+	t.keys = keys
+
+	return t
+}
+
+func arrayType(item keyType) keyType {
+	t := jsonType[[]json.RawMessage]("an array")
+	t.item = &item
+
+	return t
+}
+
+var (
+	boolType     = jsonType[bool]("a boolean")
+	stringType   = jsonType[string]("a string")
+	stringsType  = jsonType[[]string]("an array")
+	durationType = jsonType[duration]("a string")
+)
+
+// The keys of timeouts, pluginSpec, and config, which must change when those
+// structs do.
+var (
+	timeoutsType = objectType(map[string]keyType{
+		"clone":  durationType,
+		"update": durationType,
+		"build":  durationType,
+	})
+	pluginType = objectType(map[string]keyType{
+		"url":            stringType,
+		"name":           stringType,
+		"branch":         stringType,
+		"commit":         stringType,
+		"tag":            stringType,
+		"build":          stringType,
+		"timeout":        timeoutsType,
+		"opt":            boolType,
+		"pin":            boolType,
+		"skipSubmodules": boolType,
+	})
+	configType = objectType(map[string]keyType{
+		"plugins":       arrayType(pluginType),
+		"dataDir":       stringsType,
+		"keep":          stringsType,
+		"timeout":       timeoutsType,
+		"attempts":      jsonType[int]("a whole number"),
+		"urlTemplate":   stringType,
+		"stripPrefixes": stringsType,
+	})
+)
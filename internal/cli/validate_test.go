@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCheckConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		confFile string // Defaults to pluggo.json
+		config   string
+		expected []string
+	}{
+		"valid": {
+			config:   `{"dataDir": ["HOME", "pack"], "plugins": [{"url": "owner/repo"}]}`,
+			expected: []string{},
+		},
+		"every key": {
+			config: `{"dataDir": ["x"], "keep": ["a*"], "attempts": 2, "urlTemplate": "{}",` +
+				` "stripPrefixes": ["vim-"], "timeout": {"clone": "1m", "update": "1m", "build": "1m"},` +
+				` "plugins": [{"url": "a/b", "name": "b", "branch": "main", "commit": "abc",` +
+				` "build": "make", "timeout": {"clone": "1m"}, "opt": true, "skipSubmodules": true},` +
+				` {"url": "a/c", "tag": "v1"}, {"url": "a/d", "pin": true}]}`,
+			expected: []string{},
+		},
+		"syntax error": {
+			config:   "{\n  \"dataDir\": [\"x\"]\n  \"keep\": []\n}",
+			expected: []string{`3:3: invalid JSON: invalid character '"' after object key:value pair`},
+		},
+		"truncated": {
+			config:   `{"dataDir": ["x"]`,
+			expected: []string{"1:18: invalid JSON: unexpected end of JSON input"},
+		},
+		"trailing data": {
+			config:   `{"dataDir": ["x"]} {}`,
+			expected: []string{"1:20: invalid JSON: unexpected data after the top-level value"},
+		},
+		"not an object": {
+			config:   `["x"]`,
+			expected: []string{"1:1: the config must be an object, not array"},
+		},
+		"missing dataDir": {
+			config:   "{\n  \"plugins\": []\n}",
+			expected: []string{"1:1: dataDir is required"},
+		},
+		"empty dataDir": {
+			config:   `{"dataDir": []}`,
+			expected: []string{"1:13: dataDir is required"},
+		},
+		"expanded dataDir": {
+			config:   `{"dataDir": ["~", "$PACK", "${XDG_DATA_HOME}"]}`,
+			expected: []string{},
+		},
+		"unset variable in dataDir": {
+			config:   `{"dataDir": ["$NOPE", "pack"]}`,
+			expected: []string{"1:13: cannot expand dataDir: $NOPE is not set"},
+		},
+		"unknown and duplicate keys": {
+			config: "{\n  \"dataDir\": [\"x\"],\n  \"colour\": 1,\n  \"dataDir\": [\"y\"],\n" +
+				"  \"plugins\": [{\"url\": \"a/b\", \"pinned\": true}]\n}",
+			expected: []string{
+				`3:3: unknown key "colour"`,
+				`4:3: duplicate key "dataDir"`,
+				`5:30: unknown key "pinned"`,
+			},
+		},
+		"wrong types": {
+			config: `{"dataDir": ["x"], "attempts": 1.5, "timeout": {"clone": 5},` +
+				` "plugins": [{"url": "a/b", "opt": "yes"}, "c/d"]}`,
+			expected: []string{
+				"1:32: \"attempts\" must be a whole number, not number 1.5",
+				"1:58: \"clone\" must be a string, not number",
+				"1:96: \"opt\" must be a boolean, not string",
+				`1:104: each item in "plugins" must be an object, not string`,
+			},
+		},
+		"invalid settings": {
+			config: `{"dataDir": ["x"], "attempts": -1, "keep": ["[a"],` +
+				` "urlTemplate": "https://example.com/", "timeout": {"update": "soon"}}`,
+			expected: []string{
+				"1:32: attempts must be at least 1",
+				`1:45: invalid keep pattern "[a": syntax error in pattern`,
+				"1:67: urlTemplate must contain {}",
+				`1:113: invalid "update": time: invalid duration "soon"`,
+			},
+		},
+		"invalid plugins": {
+			config: "{\"dataDir\": [\"x\"], \"plugins\": [\n" +
+				"  {\"name\": \"no-url\"},\n" +
+				"  {\"url\": \"a/b\", \"name\": \"../b\"},\n" +
+				"  {\"url\": \"a/c\", \"commit\": \"abc\", \"tag\": \"v1\"},\n" +
+				"  {\"url\": \"a/d\", \"tag\": \"v1\", \"pin\": true}\n" +
+				"]}",
+			expected: []string{
+				"2:3: plugin has no url",
+				`3:18: invalid plugin name "../b": contains a path separator`,
+				`4:35: plugin "c" has both a commit and a tag`,
+				`5:31: plugin "d" has both pin and a commit or tag; use one or the other`,
+			},
+		},
+		"duplicate plugins": {
+			config: "{\"dataDir\": [\"x\"], \"stripPrefixes\": [\"vim-\"], \"plugins\": [\n" +
+				"  {\"url\": \"a/vim-b\"},\n" +
+				"  {\"url\": \"https://github.com/a/vim-b\", \"name\": \"c\"},\n" +
+				"  {\"url\": \"d/b\"}\n" +
+				"]}",
+			expected: []string{
+				`3:4: duplicate plugin url "https://github.com/a/vim-b" (first used on line 2)`,
+				`4:4: duplicate plugin name "b" (first used on line 2)`,
+			},
+		},
+		"jsonc": {
+			confFile: "pluggo.jsonc",
+			config:   "{\n  // Comment\n  \"dataDir\": [\"x\",],\n  \"colour\": 1, /* , */\n}",
+			expected: []string{`4:3: unknown key "colour"`},
+		},
+		"toml": {
+			confFile: "pluggo.toml",
+			config: "dataDir = []\n" +
+				"timeout.clone = 5\n\n" +
+				"[[plugins]]\n" +
+				"url = \"a/b\"\n" +
+				"opt = \"yes\"\n\n" +
+				"[plugins.timeout]\n" +
+				"update = \"soon\"\n\n" +
+				"[[plugins]]\n" +
+				"url = \"c/b\"\n" +
+				"pinned = true\n",
+			expected: []string{
+				"1:1: dataDir is required",
+				`2:17: "clone" must be a string, not number`,
+				`6:7: "opt" must be a boolean, not string`,
+				`9:10: invalid "update": time: invalid duration "soon"`,
+				`12:1: duplicate plugin name "b" (first used on line 5)`,
+				`13:1: unknown key "pinned"`,
+			},
+		},
+		"toml syntax error": {
+			confFile: "pluggo.toml",
+			config:   "dataDir = [\"x\"]\nattempts = = 3\n",
+			expected: []string{"2:12: invalid TOML: incomplete number"},
+		},
+		"toml duplicate key": {
+			confFile: "pluggo.toml",
+			config:   "dataDir = [\"x\"]\n[[plugins]]\nurl = \"a/b\"\nurl = \"a/c\"\n",
+			expected: []string{`4:1: invalid TOML: duplicate key "url"`},
+		},
+		"toml duplicate table": {
+			confFile: "pluggo.toml",
+			config:   "dataDir = [\"x\"]\n[timeout]\nclone = \"1m\"\n[timeout]\nupdate = \"1m\"\n",
+			expected: []string{`4:2: invalid TOML: duplicate table "timeout"`},
+		},
+		"toml table defined by dotted key": {
+			confFile: "pluggo.toml",
+			config:   "dataDir = [\"x\"]\ntimeout.clone = \"1m\"\n[timeout]\nupdate = \"1m\"\n",
+			expected: []string{`3:2: invalid TOML: duplicate table "timeout"`},
+		},
+		"toml inline table extended": {
+			confFile: "pluggo.toml",
+			config:   "dataDir = [\"x\"]\n[[plugins]]\nurl = \"a/b\"\ntimeout = {clone = \"1m\"}\n[plugins.timeout.x]\n",
+			expected: []string{`5:10: invalid TOML: cannot add to inline table "timeout"`},
+		},
+		"toml table over array of tables": {
+			confFile: "pluggo.toml",
+			config:   "dataDir = [\"x\"]\n[[plugins]]\nurl = \"a/b\"\n[plugins]\nname = \"x\"\n",
+			expected: []string{`4:2: invalid TOML: "plugins" is an array of tables`},
+		},
+	}
+
+	for msg, tc := range tests {
+		t.Run(msg, func(t *testing.T) {
+			t.Parallel()
+
+			confFile := tc.confFile
+			if confFile == "" {
+				confFile = "pluggo.json"
+			}
+			data := []byte(tc.config)
+			actual := []string{}
+			lookupEnv := fakeLookupEnv(map[string]string{"PACK": "/srv/pack"})
+			for _, prob := range checkConfig(confFile, data, "/home/u", lookupEnv) {
+				line, col := position(data, prob.offset)
+				actual = append(actual, fmt.Sprintf("%d:%d: %s", line, col, prob.msg))
+			}
+
+			if diff := cmp.Diff(tc.expected, actual); diff != "" {
+				t.Errorf("checkConfig(%q, %q) failure (-want +got)\n%s", confFile, tc.config, diff)
+			}
+		})
+	}
+}